@@ -0,0 +1,7 @@
+import os
+
+import aiohttp
+
+
+def get_api_auth():
+    return aiohttp.BasicAuth(os.getenv('API_USERNAME', ''), os.getenv('API_PASSWORD', ''))
@@ -1,6 +1,7 @@
 from log import logger
 from scheduler import get_scheduler
 from api.router import router
+from api.auth import get_api_auth
 import aiohttp
 import json
 from dto import JobCreateDeleteResponse
@@ -26,7 +27,7 @@ async def generate_and_create_movies(endpoint, count=1):
     internal_movies = await get_movies_ready_to_export(count)
     internal_movie_ids = [m.pop('id') for m in internal_movies]
     async with aiohttp.ClientSession() as session:
-        async with session.post(endpoint, data=json.dumps(internal_movies)) as r:
+        async with session.post(endpoint, data=json.dumps(internal_movies), auth=get_api_auth()) as r:
             logger.info((
                 f'Request to "{r.url}" with payload "{internal_movies}" finished '
                 f'with code {r.status} and response "{await r.text()}"'
@@ -1,6 +1,7 @@
 from log import logger
 from scheduler import get_scheduler
 from api.router import router
+from api.auth import get_api_auth
 import aiohttp
 import json
 from dto import JobCreateDeleteResponse
@@ -25,7 +26,7 @@ async def generate_and_create_tags(endpoint, count=1):
         for x in internal_data
     ]
     async with aiohttp.ClientSession() as session:
-        async with session.post(endpoint, data=json.dumps(insert_tags)) as r:
+        async with session.post(endpoint, data=json.dumps(insert_tags), auth=get_api_auth()) as r:
             logger.info((
                 f'Request to "{r.url}" with payload "{insert_tags}" finished '
                 f'with code {r.status} and response "{await r.text()}"'
@@ -1,6 +1,7 @@
 from log import logger
 from scheduler import get_scheduler
 from api.router import router
+from api.auth import get_api_auth
 import aiohttp
 import json
 from dto import JobCreateDeleteResponse
@@ -27,7 +28,7 @@ async def gen_user():
 async def generate_and_create_users(endpoint, count=1):
     users = [await gen_user() for _ in range(count)]
     async with aiohttp.ClientSession() as session:
-        async with session.post(endpoint, data=json.dumps(users)) as r:
+        async with session.post(endpoint, data=json.dumps(users), auth=get_api_auth()) as r:
             logger.info((
                 f'Request to "{r.url}" with payload "{users}" finished '
                 f'with code {r.status} and response "{await r.text()}"'
@@ -89,5 +89,7 @@ class TmdbScraper:
                         []
                     )
                 )),
-            "video_urls": [self.resolve_video_url(info) for info in m['videos']['results']],
+            "video_urls": [
+                url for url in (self.resolve_video_url(info) for info in m['videos']['results']) if url
+            ],
         }
@@ -30,7 +30,8 @@ async def consume():
                     imdb_info = imdb_scraper.collect_info(data['value'])
                     r = requests.post(
                         s.get_imdb_insert_api_path(),
-                        data=json.dumps(imdb_info)
+                        data=json.dumps(imdb_info),
+                        auth=s.get_api_auth()
                     )
                     print(imdb_info)
                     if r.status_code != 200:
@@ -42,7 +43,8 @@ async def consume():
                     tmdb_info = tmdb_scraper.collect_info(data['value'])
                     r = requests.post(
                         s.get_tmdb_insert_api_path(),
-                        data=json.dumps(tmdb_info)
+                        data=json.dumps(tmdb_info),
+                        auth=s.get_api_auth()
                     )
                     print(tmdb_info)
                     if r.status_code != 200:
@@ -13,4 +13,7 @@ def get_tmdb_insert_api_path():
     return f'{os.getenv("API_URL", "http://api:8080/api/v1")}/movie_tmdb_info'
 
 def get_tmdb_api_key():
-    return os.getenv("TMDB_API_V3_KEY")
\ No newline at end of file
+    return os.getenv("TMDB_API_V3_KEY")
+
+def get_api_auth():
+    return (os.getenv("API_USERNAME", ''), os.getenv("API_PASSWORD", ''))
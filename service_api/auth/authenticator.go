@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"example/service/api/config"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrNoCredentials is returned by authenticator when request doesn't carry its credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type Authenticator interface {
+	// Scheme is used in WWW-Authenticate header
+	Scheme() string
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type BasicAuthenticator struct {
+	Realm string
+	Users []config.BasicUser
+}
+
+func (a *BasicAuthenticator) Scheme() string {
+	return `Basic realm="` + a.Realm + `"`
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	for _, u := range a.Users {
+		if u.Username != username {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{ID: u.Username, Kind: KindBasic, Scopes: u.Scopes}, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+const ApiKeyHeader = "X-API-Key"
+
+// KeyStore looks up API key by its hash, returns ErrInvalidCredentials for unknown keys
+type KeyStore interface {
+	FindApiKey(ctx context.Context, hash string) (*Principal, error)
+}
+
+type ApiKeyAuthenticator struct {
+	Store KeyStore
+}
+
+func (a *ApiKeyAuthenticator) Scheme() string {
+	return "ApiKey"
+}
+
+func (a *ApiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(ApiKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	return a.Store.FindApiKey(r.Context(), HashApiKey(key))
+}
+
+const apiKeyPrefix = "sak_"
+
+// GenerateApiKey returns new random API key, only its hash should be stored
+func GenerateApiKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashApiKey returns digest API keys are stored and looked up by.
+// Keys are random and long, so unsalted SHA-256 is enough.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func unauthorized(g *gin.Context, authenticators []Authenticator, err error) {
+	schemes := make([]string, 0, len(authenticators))
+	for _, a := range authenticators {
+		schemes = append(schemes, a.Scheme())
+	}
+	g.Header("WWW-Authenticate", strings.Join(schemes, ", "))
+	g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+}
+
+// Authenticate tries authenticators in order and stores principal in request context.
+// With enabled=false every request gets an admin principal.
+func Authenticate(enabled bool, authenticators ...Authenticator) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if !enabled {
+			withPrincipal(g, &Principal{ID: "anonymous", Roles: []string{RoleAdmin}, Scopes: []string{ScopeAdmin}})
+			g.Next()
+			return
+		}
+
+		for _, a := range authenticators {
+			p, err := a.Authenticate(g.Request)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				unauthorized(g, authenticators, err)
+				return
+			}
+			withPrincipal(g, p)
+			g.Next()
+			return
+		}
+
+		unauthorized(g, authenticators, ErrNoCredentials)
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve <%s>", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type <%s>", k.Kty)
+	}
+}
+
+func parseJwks(data []byte) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk <%s>: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// minJwksRefreshInterval limits refreshes caused by tokens with unknown key id and retries of failed refreshes
+const minJwksRefreshInterval = time.Minute
+
+// Jwks is a set of token verification keys loaded from a file or fetched from URL.
+// Keys fetched from URL are cached for ttl and refreshed earlier when token refers to unknown key.
+// Only one refresh runs at a time, requests keep using stale keys meanwhile.
+type Jwks struct {
+	mu          sync.Mutex
+	url         string
+	ttl         time.Duration
+	client      *http.Client
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	// refreshing is closed when running refresh completes, it's nil when no refresh runs
+	refreshing chan struct{}
+}
+
+func NewJwksFromFile(path string) (*Jwks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read jwks file: %w", err)
+	}
+	keys, err := parseJwks(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Jwks{keys: keys}, nil
+}
+
+func NewJwksFromURL(url string, ttl time.Duration) *Jwks {
+	return &Jwks{url: url, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (j *Jwks) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't fetch jwks: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch jwks: %w", err)
+	}
+
+	return parseJwks(data)
+}
+
+// refresh fetches keys without holding the lock and swaps them in, it's called with j.mu locked
+func (j *Jwks) refresh() {
+	done := make(chan struct{})
+	j.refreshing = done
+	j.attemptedAt = time.Now()
+	j.mu.Unlock()
+
+	// refresh isn't canceled with the request which started it, other requests may wait for it
+	keys, err := j.fetch(context.Background())
+
+	j.mu.Lock()
+	if err == nil {
+		j.keys = keys
+		j.fetchedAt = time.Now()
+	}
+	j.fetchErr = err
+	j.refreshing = nil
+	close(done)
+}
+
+// Key returns verification key by key id
+func (j *Jwks) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.url != "" {
+		age := time.Since(j.fetchedAt)
+		_, known := j.keys[kid]
+		stale := j.keys == nil || age > j.ttl || (!known && age > minJwksRefreshInterval)
+		// failed refresh is retried after an interval, not by every request
+		if stale && j.refreshing == nil && time.Since(j.attemptedAt) > minJwksRefreshInterval {
+			j.refresh()
+		}
+		if done := j.refreshing; done != nil && j.keys == nil {
+			j.mu.Unlock()
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+			j.mu.Lock()
+		}
+		if j.keys == nil {
+			if j.fetchErr != nil {
+				return nil, j.fetchErr
+			}
+			return nil, fmt.Errorf("can't fetch jwks: %w", ctx.Err())
+		}
+	}
+
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id <%s>", kid)
+	}
+	return key, nil
+}
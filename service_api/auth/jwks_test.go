@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJwk(t *testing.T, kid string) jwk {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwk{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestJwksRefresh(t *testing.T) {
+	old, current := rsaJwk(t, "old"), rsaJwk(t, "current")
+
+	tests := []struct {
+		name string
+		// age of fetched keys and of the last fetch attempt
+		fetchedAgo, attemptedAgo time.Duration
+		cached                   []jwk
+		fetchErr                 bool
+		status                   int
+		kid                      string
+		wantFetch                bool
+		wantErr                  bool
+	}{
+		{"first request fetches keys", 0, 0, nil, false, http.StatusOK, "current", true, false},
+		{"fresh keys are cached", time.Second, time.Second, []jwk{current}, false, http.StatusOK, "current", false, false},
+		{"expired keys are refreshed", 2 * time.Hour, 2 * time.Hour, []jwk{current}, false, http.StatusOK, "current", true, false},
+		{"unknown key id refreshes keys", 2 * time.Minute, 2 * time.Minute, []jwk{old}, false, http.StatusOK, "current", true, false},
+		{"unknown key id doesn't refresh recent keys", time.Second, time.Second, []jwk{old}, false, http.StatusOK, "current", false, true},
+		{"failed refresh keeps stale keys", 2 * time.Hour, 2 * time.Hour, []jwk{current}, false, http.StatusInternalServerError, "current", true, false},
+		{"failed refresh isn't retried by every request", 2 * time.Hour, time.Second, []jwk{current}, true, http.StatusOK, "current", false, false},
+		{"failed first fetch is reported", 0, 0, nil, false, http.StatusInternalServerError, "current", true, true},
+		{"failed first fetch backs off", 0, time.Second, nil, true, http.StatusOK, "current", false, true},
+		{"failed first fetch is retried after interval", 0, 2 * time.Minute, nil, true, http.StatusOK, "current", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&fetches, 1)
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				json.NewEncoder(w).Encode(jwkSet{Keys: []jwk{old, current}})
+			}))
+			defer server.Close()
+
+			j := NewJwksFromURL(server.URL, time.Hour)
+			now := time.Now()
+			if tt.cached != nil {
+				data, _ := json.Marshal(jwkSet{Keys: tt.cached})
+				keys, err := parseJwks(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				j.keys = keys
+				j.fetchedAt = now.Add(-tt.fetchedAgo)
+			}
+			if tt.attemptedAgo > 0 {
+				j.attemptedAt = now.Add(-tt.attemptedAgo)
+			}
+			if tt.fetchErr {
+				j.fetchErr = errors.New("can't fetch jwks: status 500")
+			}
+
+			key, err := j.Key(context.Background(), tt.kid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Key(%s) error = %v, want error %v", tt.kid, err, tt.wantErr)
+			}
+			if !tt.wantErr && key == nil {
+				t.Errorf("Key(%s) = nil", tt.kid)
+			}
+			if got := atomic.LoadInt32(&fetches) > 0; got != tt.wantFetch {
+				t.Errorf("fetched = %v, want %v", got, tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestParseJwks(t *testing.T) {
+	current := rsaJwk(t, "current")
+	encryption := rsaJwk(t, "encryption")
+	encryption.Use = "enc"
+	ec := jwk{Kid: "ec", Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}
+	okp := jwk{Kid: "okp", Kty: "OKP"}
+
+	tests := []struct {
+		name    string
+		keys    []jwk
+		want    []string
+		wantErr bool
+	}{
+		{"signing key", []jwk{current}, []string{"current"}, false},
+		{"encryption keys are skipped", []jwk{current, encryption}, []string{"current"}, false},
+		{"point off curve", []jwk{ec}, nil, true},
+		{"unsupported key type", []jwk{okp}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(jwkSet{Keys: tt.keys})
+			keys, err := parseJwks(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJwks() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("parseJwks() = %d keys, want %v", len(keys), tt.want)
+			}
+			for _, kid := range tt.want {
+				if keys[kid] == nil {
+					t.Errorf("parseJwks() has no key <%s>", kid)
+				}
+			}
+		})
+	}
+}
+
+func TestJwksConcurrentRefresh(t *testing.T) {
+	current := rsaJwk(t, "current")
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(jwkSet{Keys: []jwk{current}})
+	}))
+	defer server.Close()
+
+	j := NewJwksFromURL(server.URL, time.Hour)
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := j.Key(context.Background(), "current")
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Key() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetched %d times, want once", got)
+	}
+}
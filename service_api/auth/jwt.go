@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const KindJwt = "jwt"
+
+// JwtAuthenticator validates bearer tokens signed with RS256 or ES256
+// and maps roles from token claims to scopes
+type JwtAuthenticator struct {
+	Keys     *Jwks
+	Issuer   string
+	Audience string
+	// RolesClaim is a dot separated path to list of roles, e.g. "realm_access.roles"
+	RolesClaim string
+	RoleScopes map[string][]string
+	// UserIDClaim holds numeric id of the User the token is issued for, numeric sub is used when it's missing
+	UserIDClaim string
+	Leeway      time.Duration
+}
+
+func (a *JwtAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+func (a *JwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithoutClaimsValidation(),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(strings.TrimSpace(header[7:]), claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.Keys.Key(r.Context(), kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err.Error())
+	}
+
+	if err := a.validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err.Error())
+	}
+
+	sub, _ := claims["sub"].(string)
+	roles := a.roles(claims)
+
+	return &Principal{ID: sub, Kind: KindJwt, UserID: a.userID(claims, sub), Roles: roles, Scopes: a.scopes(roles)}, nil
+}
+
+func (a *JwtAuthenticator) userID(claims jwt.MapClaims, sub string) uint {
+	switch v := claims[a.UserIDClaim].(type) {
+	case float64:
+		if v > 0 {
+			return uint(v)
+		}
+	case string:
+		return ParseUserID(v)
+	}
+	return ParseUserID(sub)
+}
+
+func (a *JwtAuthenticator) validate(claims jwt.MapClaims) error {
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-a.Leeway).Unix(), true) {
+		return fmt.Errorf("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(a.Leeway).Unix(), false) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if a.Issuer != "" && !claims.VerifyIssuer(a.Issuer, true) {
+		return fmt.Errorf("unexpected token issuer")
+	}
+	if a.Audience != "" && !claims.VerifyAudience(a.Audience, true) {
+		return fmt.Errorf("unexpected token audience")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return fmt.Errorf("token has no subject")
+	}
+	return nil
+}
+
+func (a *JwtAuthenticator) roles(claims jwt.MapClaims) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(a.RolesClaim, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
+
+func (a *JwtAuthenticator) scopes(roles []string) []string {
+	var scopes []string
+	for _, r := range roles {
+		scopes = append(scopes, a.RoleScopes[r]...)
+	}
+	return scopes
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJwtAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &JwtAuthenticator{
+		Keys:        &Jwks{keys: map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}},
+		Issuer:      "https://issuer.example",
+		Audience:    "service_api",
+		RolesClaim:  "realm_access.roles",
+		UserIDClaim: "user_id",
+		Leeway:      30 * time.Second,
+	}
+
+	now := time.Now()
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":          "42",
+			"iss":          "https://issuer.example",
+			"aud":          "service_api",
+			"exp":          now.Add(time.Hour).Unix(),
+			"nbf":          now.Add(-time.Minute).Unix(),
+			"realm_access": map[string]interface{}{"roles": []interface{}{RoleUser}},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"RS256", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)), nil},
+		{"ES256", sign(jwt.SigningMethodES256, "ec", ecKey, claims(nil)), nil},
+		{"HS256 with public key as secret", sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil)), ErrInvalidCredentials},
+		{"none algorithm", sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, claims(nil)), ErrInvalidCredentials},
+		{"other signing key", sign(jwt.SigningMethodRS256, "rsa", otherKey, claims(nil)), ErrInvalidCredentials},
+		{"unknown key id", sign(jwt.SigningMethodRS256, "other", rsaKey, claims(nil)), ErrInvalidCredentials},
+		{"other issuer", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["iss"] = "https://other.example" })), ErrInvalidCredentials},
+		{"other audience", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["aud"] = "other" })), ErrInvalidCredentials},
+		{"audience list", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["aud"] = []interface{}{"other", "service_api"} })), nil},
+		{"expired", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() })), ErrInvalidCredentials},
+		{"expired within leeway", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-10 * time.Second).Unix() })), nil},
+		{"no expiration", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { delete(c, "exp") })), ErrInvalidCredentials},
+		{"not valid yet", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() })), ErrInvalidCredentials},
+		{"not before within leeway", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["nbf"] = now.Add(10 * time.Second).Unix() })), nil},
+		{"no subject", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { delete(c, "sub") })), ErrInvalidCredentials},
+		{"malformed token", "not.a.token", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			p, err := a.Authenticate(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if p.ID != "42" || p.Kind != KindJwt || p.UserID != 42 {
+				t.Errorf("Authenticate() = %+v, want subject and user 42", p)
+			}
+			if len(p.Roles) != 1 || p.Roles[0] != RoleUser {
+				t.Errorf("Authenticate() roles = %v, want [%s]", p.Roles, RoleUser)
+			}
+		})
+	}
+}
+
+func TestJwtAuthenticateWithoutToken(t *testing.T) {
+	a := &JwtAuthenticator{Keys: &Jwks{}}
+
+	for _, header := range []string{"", "Basic dXNlcjpwdw==", "Bearer"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if _, err := a.Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Authenticate() with header <%s> error = %v, want %v", header, err, ErrNoCredentials)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleReader  = "reader"
+	RoleUser    = "user"
+	RoleCurator = "curator"
+	RoleService = "service"
+	RoleAdmin   = "admin"
+)
+
+const (
+	ResourceUsers         = "users"
+	ResourceMovies        = "movies"
+	ResourceRatings       = "ratings"
+	ResourceTags          = "tags"
+	ResourceMovieImdbInfo = "movie_imdb_info"
+	ResourceMovieTmdbInfo = "movie_tmdb_info"
+	ResourceDb            = "db"
+	ResourceApiKeys       = "api_keys"
+	ResourceAudit         = "audit"
+)
+
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionExport = "export"
+	ActionErase  = "erase"
+)
+
+// Any matches every role, resource or action in a Rule
+const Any = "*"
+
+// Rule grants roles actions on resources. With OwnerOnly set the grant only
+// covers objects that belong to the principal's user.
+type Rule struct {
+	Roles     []string
+	Resources []string
+	Actions   []string
+	OwnerOnly bool
+}
+
+// Policy is a list of rules, a request is allowed when any rule matches
+type Policy []Rule
+
+type Decision int
+
+const (
+	Deny Decision = iota
+	// AllowOwner allows the action on objects owned by the principal
+	AllowOwner
+	Allow
+)
+
+var content = []string{ResourceUsers, ResourceMovies, ResourceRatings, ResourceTags, ResourceMovieImdbInfo, ResourceMovieTmdbInfo}
+var public = []string{ResourceMovies, ResourceRatings, ResourceTags, ResourceMovieImdbInfo, ResourceMovieTmdbInfo}
+var mutations = []string{ActionCreate, ActionUpdate, ActionDelete}
+
+// DefaultPolicy:
+// everybody may read movies, ratings and tags, users hold PII and end users read, export or erase only their own,
+// end users mutate only their own ratings and tags, curators edit movies and external info,
+// services (trusted machine clients) read and edit all content
+// and admins additionally run database operations, manage API keys and read the audit log
+var DefaultPolicy = Policy{
+	{Roles: []string{Any}, Resources: public, Actions: []string{ActionRead}},
+	{Roles: []string{RoleUser, RoleCurator}, Resources: []string{ResourceRatings, ResourceTags}, Actions: mutations, OwnerOnly: true},
+	{Roles: []string{RoleUser, RoleCurator}, Resources: []string{ResourceUsers}, Actions: []string{ActionRead, ActionExport, ActionErase}, OwnerOnly: true},
+	{Roles: []string{RoleCurator}, Resources: []string{ResourceMovies, ResourceMovieImdbInfo, ResourceMovieTmdbInfo}, Actions: mutations},
+	{Roles: []string{RoleService}, Resources: content, Actions: append([]string{ActionRead}, mutations...)},
+	{Roles: []string{RoleAdmin}, Resources: []string{Any}, Actions: []string{Any}},
+}
+
+func matches(values []string, value string) bool {
+	for _, v := range values {
+		if v == Any || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide returns the strongest decision of rules matching any of roles
+func (p Policy) Decide(roles []string, resource, action string) Decision {
+	decision := Deny
+	for _, rule := range p {
+		if !matches(rule.Resources, resource) || !matches(rule.Actions, action) {
+			continue
+		}
+		for _, role := range roles {
+			if !matches(rule.Roles, role) {
+				continue
+			}
+			if !rule.OwnerOnly {
+				return Allow
+			}
+			decision = AllowOwner
+		}
+	}
+	return decision
+}
+
+// scopeRoles gives policy roles to principals by their scopes, e.g. API keys or token roles mapped to scopes
+var scopeRoles = map[string]string{
+	ScopeRead:  RoleReader,
+	ScopeWrite: RoleService,
+	ScopeAdmin: RoleAdmin,
+}
+
+// EffectiveRoles returns principal roles together with roles derived from its scopes
+func (p *Principal) EffectiveRoles() []string {
+	roles := append([]string{}, p.Roles...)
+	for _, s := range p.Scopes {
+		if r, ok := scopeRoles[s]; ok && !matches(roles, r) {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+func methodAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return ActionRead
+	case http.MethodPost:
+		return ActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return ActionUpdate
+	case http.MethodDelete:
+		return ActionDelete
+	default:
+		return ""
+	}
+}
+
+const decisionKey = "auth:decision"
+
+// Authorize checks policy for resource, the action is derived from request method
+func Authorize(policy Policy, resource string) gin.HandlerFunc {
+	return AuthorizeAction(policy, resource, "")
+}
+
+// AuthorizeAction checks policy for resource and action, empty action is derived from request method
+func AuthorizeAction(policy Policy, resource, action string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		p := FromGin(g)
+		if p == nil {
+			g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrNoCredentials.Error()})
+			return
+		}
+
+		a := action
+		if a == "" {
+			a = methodAction(g.Request.Method)
+		}
+
+		decision := policy.Decide(p.EffectiveRoles(), resource, a)
+		if decision == Deny {
+			g.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "action <" + a + "> on <" + resource + "> is not allowed"})
+			return
+		}
+		g.Set(decisionKey, decision)
+		g.Next()
+	}
+}
+
+// Allowed reports whether principal of request may take action on resource object owned by user ownerID,
+// it's used for objects reached other than by their own routes, e.g. included ones
+func Allowed(g *gin.Context, policy Policy, resource, action string, ownerID uint) bool {
+	p := FromGin(g)
+	if p == nil {
+		return false
+	}
+	switch policy.Decide(p.EffectiveRoles(), resource, action) {
+	case Allow:
+		return true
+	case AllowOwner:
+		return p.UserID != 0 && p.UserID == ownerID
+	default:
+		return false
+	}
+}
+
+// OwnedBy returns user whose objects request is limited to, ok is false when request isn't limited
+func OwnedBy(g *gin.Context) (userID uint, ok bool) {
+	if d, _ := g.Get(decisionKey); d != AllowOwner {
+		return 0, false
+	}
+	if p := FromGin(g); p != nil {
+		return p.UserID, true
+	}
+	return 0, true
+}
+
+// IsOwner reports whether request may act on objects of user userID.
+// Requests allowed without ownership condition may act on any user's objects.
+func IsOwner(g *gin.Context, userID uint) bool {
+	if d, _ := g.Get(decisionKey); d != AllowOwner {
+		return true
+	}
+	p := FromGin(g)
+	return p != nil && p.UserID != 0 && p.UserID == userID
+}
+
+// ParseUserID parses numeric user id, zero when value isn't one
+func ParseUserID(value string) uint {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
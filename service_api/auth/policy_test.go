@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDefaultPolicyDecide(t *testing.T) {
+	tests := []struct {
+		name     string
+		roles    []string
+		resource string
+		action   string
+		want     Decision
+	}{
+		{"anybody reads movies", []string{"unknown"}, ResourceMovies, ActionRead, Allow},
+		{"no roles read", nil, ResourceRatings, ActionRead, Deny},
+		{"reader can't rate", []string{RoleReader}, ResourceRatings, ActionCreate, Deny},
+		{"user rates own", []string{RoleUser}, ResourceRatings, ActionCreate, AllowOwner},
+		{"user deletes own tags", []string{RoleUser}, ResourceTags, ActionDelete, AllowOwner},
+		{"anybody can't read users", []string{"unknown"}, ResourceUsers, ActionRead, Deny},
+		{"reader can't read users", []string{RoleReader}, ResourceUsers, ActionRead, Deny},
+		{"user reads own profile", []string{RoleUser}, ResourceUsers, ActionRead, AllowOwner},
+		{"user exports own data", []string{RoleUser}, ResourceUsers, ActionExport, AllowOwner},
+		{"user can't edit movies", []string{RoleUser}, ResourceMovies, ActionUpdate, Deny},
+		{"user can't read audit", []string{RoleUser}, ResourceAudit, ActionRead, Deny},
+		{"curator edits movies", []string{RoleCurator}, ResourceMovieImdbInfo, ActionUpdate, Allow},
+		{"curator rates own", []string{RoleCurator}, ResourceRatings, ActionUpdate, AllowOwner},
+		{"curator can't create users", []string{RoleCurator}, ResourceUsers, ActionCreate, Deny},
+		{"curator reads own profile", []string{RoleCurator}, ResourceUsers, ActionRead, AllowOwner},
+		{"service reads users", []string{RoleService}, ResourceUsers, ActionRead, Allow},
+		{"service edits ratings", []string{RoleService}, ResourceRatings, ActionUpdate, Allow},
+		{"service can't erase users", []string{RoleService}, ResourceUsers, ActionErase, Deny},
+		{"service can't manage api keys", []string{RoleService}, ResourceApiKeys, ActionCreate, Deny},
+		{"strongest role wins", []string{RoleUser, RoleService}, ResourceRatings, ActionDelete, Allow},
+		{"admin runs db operations", []string{RoleAdmin}, ResourceDb, ActionCreate, Allow},
+		{"admin erases users", []string{RoleAdmin}, ResourceUsers, ActionErase, Allow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultPolicy.Decide(tt.roles, tt.resource, tt.action); got != tt.want {
+				t.Errorf("Decide(%v, %s, %s) = %v, want %v", tt.roles, tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		want      []string
+	}{
+		{"roles only", Principal{Roles: []string{RoleUser}}, []string{RoleUser}},
+		{"scopes only", Principal{Scopes: []string{ScopeRead, ScopeWrite}}, []string{RoleReader, RoleService}},
+		{"token role mapped to scope", Principal{Roles: []string{"editor"}, Scopes: []string{ScopeWrite}}, []string{"editor", RoleService}},
+		{"duplicate role", Principal{Roles: []string{RoleAdmin}, Scopes: []string{ScopeAdmin}}, []string{RoleAdmin}},
+		{"unknown scope", Principal{Scopes: []string{"other"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.principal.EffectiveRoles()
+			if len(got) != len(tt.want) {
+				t.Fatalf("EffectiveRoles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("EffectiveRoles() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		decision  interface{}
+		userID    uint
+		want      bool
+	}{
+		{"allowed without ownership", &Principal{UserID: 1}, Allow, 2, true},
+		{"owner", &Principal{UserID: 1}, AllowOwner, 1, true},
+		{"other user", &Principal{UserID: 1}, AllowOwner, 2, false},
+		{"principal without user", &Principal{}, AllowOwner, 0, false},
+		{"anonymous", nil, AllowOwner, 1, false},
+		{"no decision", nil, nil, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := gin.CreateTestContext(httptest.NewRecorder())
+			g.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.principal != nil {
+				withPrincipal(g, tt.principal)
+			}
+			if tt.decision != nil {
+				g.Set(decisionKey, tt.decision)
+			}
+			if got := IsOwner(g, tt.userID); got != tt.want {
+				t.Errorf("IsOwner(%d) = %v, want %v", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		ownerID   uint
+		want      bool
+	}{
+		{"anonymous", nil, 1, false},
+		{"reader", &Principal{Roles: []string{RoleReader}}, 1, false},
+		{"owner", &Principal{UserID: 1, Roles: []string{RoleUser}}, 1, true},
+		{"other user", &Principal{UserID: 2, Roles: []string{RoleUser}}, 1, false},
+		{"principal without user", &Principal{Roles: []string{RoleUser}}, 0, false},
+		{"service", &Principal{Roles: []string{RoleService}}, 1, true},
+		{"admin", &Principal{Roles: []string{RoleAdmin}}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := gin.CreateTestContext(httptest.NewRecorder())
+			g.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.principal != nil {
+				withPrincipal(g, tt.principal)
+			}
+			if got := Allowed(g, DefaultPolicy, ResourceUsers, ActionRead, tt.ownerID); got != tt.want {
+				t.Errorf("Allowed(users, read, %d) = %v, want %v", tt.ownerID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUsersRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		userID    uint
+		status    int
+	}{
+		{"reader", &Principal{Roles: []string{RoleReader}}, 1, http.StatusForbidden},
+		{"owner", &Principal{UserID: 1, Roles: []string{RoleUser}}, 1, http.StatusOK},
+		{"other user", &Principal{UserID: 2, Roles: []string{RoleUser}}, 1, http.StatusForbidden},
+		{"service", &Principal{Roles: []string{RoleService}}, 1, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+			r.GET("/users/:id", func(g *gin.Context) {
+				withPrincipal(g, tt.principal)
+			}, Authorize(DefaultPolicy, ResourceUsers), func(g *gin.Context) {
+				if !IsOwner(g, tt.userID) {
+					g.Status(http.StatusForbidden)
+					return
+				}
+				g.Status(http.StatusOK)
+			})
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+			if w.Code != tt.status {
+				t.Errorf("GET /users/1 = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var validScopes = map[string]bool{
+	ScopeRead:  true,
+	ScopeWrite: true,
+	ScopeAdmin: true,
+}
+
+func ValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+const (
+	KindBasic  = "basic"
+	KindApiKey = "api_key"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// UserID links principal to a User, zero for service principals
+	UserID uint     `json:"user_id,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+const principalKey = "auth:principal"
+
+type principalCtxKey struct{}
+
+func withPrincipal(g *gin.Context, p *Principal) {
+	g.Set(principalKey, p)
+	g.Request = g.Request.WithContext(context.WithValue(g.Request.Context(), principalCtxKey{}, p))
+}
+
+// FromContext returns principal of the request ctx belongs to, nil for anonymous requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalCtxKey{}).(*Principal)
+	return p
+}
+
+// FromGin returns principal of the request, nil for anonymous requests
+func FromGin(g *gin.Context) *Principal {
+	v, ok := g.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Principal)
+}
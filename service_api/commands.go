@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"example/service/api/config"
+	db "example/service/api/db"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runCommand runs maintenance command instead of the server:
+//
+//	reencrypt [-batch-size N]  re-encrypts user PII with the active key
+//	purge [-retention D]       permanently deletes objects soft deleted before retention period
+//	rebuild-rating-stats       recomputes movie rating stats from ratings
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "reencrypt":
+		flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+		batchSize := flags.Int("batch-size", 500, "users loaded per batch")
+		flags.Parse(args[1:])
+
+		count, err := db.ReencryptUsers(ctx, *batchSize)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"users": count}).Info("Re-encryption finished")
+		return nil
+	case "purge":
+		flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+		retention := flags.Duration("retention", config.GetPurgeConfig().Retention, "how long deleted objects are kept")
+		flags.Parse(args[1:])
+
+		_, err := db.PurgeDeleted(ctx, *retention)
+		return err
+	case "rebuild-rating-stats":
+		_, err := db.RebuildRatingStats(ctx)
+		return err
+	default:
+		return fmt.Errorf("unknown command <%s>, expected reencrypt, purge or rebuild-rating-stats", args[0])
+	}
+}
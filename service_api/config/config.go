@@ -2,20 +2,142 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 const config_file_name = "config"
 
+const (
+	DbDriverPostgres = "postgres"
+	DbDriverMysql    = "mysql"
+	DbDriverSqlite   = "sqlite"
+)
+
 func InitConfig() {
 	viper.SetConfigName(config_file_name)
 	viper.AddConfigPath(".")
+	viper.SetDefault("DB_DRIVER", DbDriverPostgres)
+	viper.SetDefault("SQLITE_PATH", "example.db")
+	viper.SetDefault("MYSQL_PORT", 3306)
+	viper.SetDefault("DB_MAX_OPEN_CONNS", 25)
+	viper.SetDefault("DB_MAX_IDLE_CONNS", 10)
+	viper.SetDefault("DB_CONN_MAX_LIFETIME", "30m")
+	viper.SetDefault("DB_CONN_MAX_IDLE_TIME", "5m")
+	viper.SetDefault("DB_STATEMENT_TIMEOUT", "30s")
+	viper.SetDefault("DB_CONNECT_RETRIES", 10)
+	viper.SetDefault("DB_CONNECT_BACKOFF", "500ms")
+	viper.SetDefault("DB_CONNECT_MAX_BACKOFF", "30s")
+	viper.SetDefault("REQUEST_TIMEOUT", "60s")
+	viper.SetDefault("DB_AUTO_MIGRATE", false)
+	viper.SetDefault("PORT", 8080)
+	viper.SetDefault("AUTH_ENABLED", true)
+	viper.SetDefault("AUTH_REALM", "service_api")
+	viper.SetDefault("JWT_ENABLED", false)
+	viper.SetDefault("JWT_JWKS_CACHE_TTL", "1h")
+	viper.SetDefault("JWT_ROLES_CLAIM", "roles")
+	// token roles of the access policy need no mapping, JWT_ROLE_SCOPES grants scopes to other roles
+	viper.SetDefault("JWT_ROLE_SCOPES", "")
+	viper.SetDefault("JWT_USER_ID_CLAIM", "user_id")
+	viper.SetDefault("JWT_LEEWAY", "30s")
+	viper.SetDefault("RATE_LIMIT_ENABLED", true)
+	viper.SetDefault("RATE_LIMIT_READ_RATE", 50)
+	viper.SetDefault("RATE_LIMIT_READ_BURST", 100)
+	viper.SetDefault("RATE_LIMIT_WRITE_RATE", 10)
+	viper.SetDefault("RATE_LIMIT_WRITE_BURST", 20)
+	viper.SetDefault("RATE_LIMIT_BATCH_RATE", 1)
+	viper.SetDefault("RATE_LIMIT_BATCH_BURST", 5)
+	viper.SetDefault("RATE_LIMIT_AUTH_RATE", 0.2)
+	viper.SetDefault("RATE_LIMIT_AUTH_BURST", 10)
+	// client IPs come from X-Forwarded-For only when the request is sent by a trusted proxy
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("MAX_BODY_BYTES", 10<<20)
+	viper.SetDefault("MAX_BATCH_SIZE", 1000)
+	viper.SetDefault("GDPR_ERASE_RATINGS", "keep")
+	viper.SetDefault("GDPR_ERASE_TAGS", "delete")
+	viper.SetDefault("ON_DELETE_USER", "restrict")
+	viper.SetDefault("ON_DELETE_MOVIE", "restrict")
+	viper.SetDefault("REQUIRE_IF_MATCH", false)
+	viper.SetDefault("PURGE_RETENTION", "720h")
+	viper.SetDefault("PURGE_INTERVAL", "0")
+	viper.SetDefault("GENRE_VOCABULARY", strings.Join(defaultGenres, ","))
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("LOG_REDACT_FIELDS", "email,address,name")
+	viper.SetDefault("TRACING_EXPORTER", "none")
+	viper.SetDefault("TRACING_SERVICE_NAME", "service_api")
+	viper.SetDefault("TRACING_OTLP_ENDPOINT", "localhost:4318")
+	viper.SetDefault("TRACING_OTLP_INSECURE", true)
+	viper.SetDefault("TRACING_FILE_PATH", "traces.json")
+	viper.SetDefault("TRACING_SAMPLE_RATIO", 1.0)
+	viper.BindEnv("DB_DRIVER")
 	viper.BindEnv("POSTGRES_USER")
 	viper.BindEnv("POSTGRES_PASSWORD")
 	viper.BindEnv("POSTGRES_HOST")
 	viper.BindEnv("POSTGRES_PORT")
 	viper.BindEnv("POSTGRES_DB")
+	viper.BindEnv("MYSQL_USER")
+	viper.BindEnv("MYSQL_PASSWORD")
+	viper.BindEnv("MYSQL_HOST")
+	viper.BindEnv("MYSQL_PORT")
+	viper.BindEnv("MYSQL_DB")
+	viper.BindEnv("SQLITE_PATH")
+	viper.BindEnv("DB_MAX_OPEN_CONNS")
+	viper.BindEnv("DB_MAX_IDLE_CONNS")
+	viper.BindEnv("DB_CONN_MAX_LIFETIME")
+	viper.BindEnv("DB_CONN_MAX_IDLE_TIME")
+	viper.BindEnv("DB_STATEMENT_TIMEOUT")
+	viper.BindEnv("DB_CONNECT_RETRIES")
+	viper.BindEnv("DB_CONNECT_BACKOFF")
+	viper.BindEnv("DB_CONNECT_MAX_BACKOFF")
+	viper.BindEnv("REQUEST_TIMEOUT")
+	viper.BindEnv("DB_AUTO_MIGRATE")
+	viper.BindEnv("PORT")
+	viper.BindEnv("AUTH_ENABLED")
+	viper.BindEnv("AUTH_REALM")
+	viper.BindEnv("AUTH_BASIC_USERS")
+	viper.BindEnv("JWT_ENABLED")
+	viper.BindEnv("JWT_JWKS_FILE")
+	viper.BindEnv("JWT_JWKS_URL")
+	viper.BindEnv("JWT_JWKS_CACHE_TTL")
+	viper.BindEnv("JWT_ISSUER")
+	viper.BindEnv("JWT_AUDIENCE")
+	viper.BindEnv("JWT_ROLES_CLAIM")
+	viper.BindEnv("JWT_ROLE_SCOPES")
+	viper.BindEnv("JWT_USER_ID_CLAIM")
+	viper.BindEnv("JWT_LEEWAY")
+	viper.BindEnv("RATE_LIMIT_ENABLED")
+	viper.BindEnv("RATE_LIMIT_READ_RATE")
+	viper.BindEnv("RATE_LIMIT_READ_BURST")
+	viper.BindEnv("RATE_LIMIT_WRITE_RATE")
+	viper.BindEnv("RATE_LIMIT_WRITE_BURST")
+	viper.BindEnv("RATE_LIMIT_BATCH_RATE")
+	viper.BindEnv("RATE_LIMIT_BATCH_BURST")
+	viper.BindEnv("RATE_LIMIT_AUTH_RATE")
+	viper.BindEnv("RATE_LIMIT_AUTH_BURST")
+	viper.BindEnv("TRUSTED_PROXIES")
+	viper.BindEnv("MAX_BODY_BYTES")
+	viper.BindEnv("MAX_BATCH_SIZE")
+	viper.BindEnv("GDPR_ERASE_RATINGS")
+	viper.BindEnv("GDPR_ERASE_TAGS")
+	viper.BindEnv("ENCRYPTION_KEYS_FILE")
+	viper.BindEnv("ON_DELETE_USER")
+	viper.BindEnv("ON_DELETE_MOVIE")
+	viper.BindEnv("REQUIRE_IF_MATCH")
+	viper.BindEnv("PURGE_RETENTION")
+	viper.BindEnv("PURGE_INTERVAL")
+	viper.BindEnv("GENRE_VOCABULARY")
+	viper.BindEnv("LOG_LEVEL")
+	viper.BindEnv("LOG_FORMAT")
+	viper.BindEnv("LOG_REDACT_FIELDS")
+	viper.BindEnv("TRACING_EXPORTER")
+	viper.BindEnv("TRACING_SERVICE_NAME")
+	viper.BindEnv("TRACING_OTLP_ENDPOINT")
+	viper.BindEnv("TRACING_OTLP_INSECURE")
+	viper.BindEnv("TRACING_FILE_PATH")
+	viper.BindEnv("TRACING_SAMPLE_RATIO")
 	viper.BindEnv("KAFKA_URL")
 	viper.BindEnv("OBJECT_CREATION_TOPIC_NAME")
 	err := viper.ReadInConfig()
@@ -24,6 +146,271 @@ func InitConfig() {
 	}
 }
 
+// GetListenAddress returns address http server listens on, 0.0.0.0:8080 by default
+func GetListenAddress() string {
+	return fmt.Sprintf(":%d", viper.GetInt("PORT"))
+}
+
+type BasicUser struct {
+	Username     string   `mapstructure:"username"`
+	PasswordHash string   `mapstructure:"password_hash"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+type AuthConfig struct {
+	Enabled bool
+	Realm   string
+	// BasicUsers are read from "auth.basic_users" list of config file
+	// and from AUTH_BASIC_USERS variable formatted as "username:bcrypt_hash:scope|scope,..."
+	BasicUsers []BasicUser
+}
+
+func parseBasicUsers(value string) ([]BasicUser, error) {
+	var users []BasicUser
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid basic user <%s>, expected username:bcrypt_hash:scopes", parts[0])
+		}
+		users = append(users, BasicUser{Username: parts[0], PasswordHash: parts[1], Scopes: strings.Split(parts[2], "|")})
+	}
+	return users, nil
+}
+
+func GetAuthConfig() (AuthConfig, error) {
+	cfg := AuthConfig{
+		Enabled: viper.GetBool("AUTH_ENABLED"),
+		Realm:   viper.GetString("AUTH_REALM"),
+	}
+
+	if err := viper.UnmarshalKey("auth.basic_users", &cfg.BasicUsers); err != nil {
+		return cfg, fmt.Errorf("invalid auth.basic_users: %w", err)
+	}
+
+	users, err := parseBasicUsers(viper.GetString("AUTH_BASIC_USERS"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.BasicUsers = append(cfg.BasicUsers, users...)
+
+	return cfg, nil
+}
+
+type JwtConfig struct {
+	Enabled bool
+	// JwksFile takes precedence over JwksURL
+	JwksFile     string
+	JwksURL      string
+	JwksCacheTTL time.Duration
+	Issuer       string
+	Audience     string
+	RolesClaim   string
+	RoleScopes   map[string][]string
+	UserIDClaim  string
+	Leeway       time.Duration
+}
+
+// parseRoleScopes parses "role:scope|scope,..." list
+func parseRoleScopes(value string) (map[string][]string, error) {
+	roles := map[string][]string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid role mapping <%s>, expected role:scopes", item)
+		}
+		roles[parts[0]] = strings.Split(parts[1], "|")
+	}
+	return roles, nil
+}
+
+func GetJwtConfig() (JwtConfig, error) {
+	cfg := JwtConfig{
+		Enabled:      viper.GetBool("JWT_ENABLED"),
+		JwksFile:     viper.GetString("JWT_JWKS_FILE"),
+		JwksURL:      viper.GetString("JWT_JWKS_URL"),
+		JwksCacheTTL: viper.GetDuration("JWT_JWKS_CACHE_TTL"),
+		Issuer:       viper.GetString("JWT_ISSUER"),
+		Audience:     viper.GetString("JWT_AUDIENCE"),
+		RolesClaim:   viper.GetString("JWT_ROLES_CLAIM"),
+		UserIDClaim:  viper.GetString("JWT_USER_ID_CLAIM"),
+		Leeway:       viper.GetDuration("JWT_LEEWAY"),
+	}
+
+	roles, err := parseRoleScopes(viper.GetString("JWT_ROLE_SCOPES"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.RoleScopes = roles
+
+	if cfg.Enabled && cfg.JwksFile == "" && cfg.JwksURL == "" {
+		return cfg, fmt.Errorf("JWT_JWKS_FILE or JWT_JWKS_URL is required when JWT authentication is enabled")
+	}
+
+	return cfg, nil
+}
+
+type RateLimit struct {
+	// Rate is number of requests per second
+	Rate  float64
+	Burst int
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Groups maps route group (read, write, batch) to its limit, auth group limits failed authentication per IP
+	Groups map[string]RateLimit
+}
+
+func GetRateLimitConfig() RateLimitConfig {
+	cfg := RateLimitConfig{
+		Enabled: viper.GetBool("RATE_LIMIT_ENABLED"),
+		Groups:  map[string]RateLimit{},
+	}
+	for _, group := range []string{"read", "write", "batch", "auth"} {
+		key := "RATE_LIMIT_" + strings.ToUpper(group)
+		cfg.Groups[group] = RateLimit{Rate: viper.GetFloat64(key + "_RATE"), Burst: viper.GetInt(key + "_BURST")}
+	}
+	return cfg
+}
+
+// GetTrustedProxies returns comma separated IPs and CIDRs of TRUSTED_PROXIES, no proxy is trusted by default
+func GetTrustedProxies() []string {
+	proxies := []string{}
+	for _, p := range strings.Split(viper.GetString("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// GetMaxBodyBytes returns maximum size of API request body, zero disables the check
+func GetMaxBodyBytes() int64 {
+	return viper.GetInt64("MAX_BODY_BYTES")
+}
+
+// GetMaxBatchSize returns maximum number of objects in insert_batch request, zero disables the check
+func GetMaxBatchSize() int {
+	return viper.GetInt("MAX_BATCH_SIZE")
+}
+
+const (
+	GdprKeep   = "keep"
+	GdprDelete = "delete"
+)
+
+// GdprConfig decides what happens to ratings and tags of erased users,
+// kept objects stay linked to the anonymized user
+type GdprConfig struct {
+	Ratings string
+	Tags    string
+}
+
+func GetGdprConfig() (GdprConfig, error) {
+	cfg := GdprConfig{
+		Ratings: viper.GetString("GDPR_ERASE_RATINGS"),
+		Tags:    viper.GetString("GDPR_ERASE_TAGS"),
+	}
+	for name, v := range map[string]string{"GDPR_ERASE_RATINGS": cfg.Ratings, "GDPR_ERASE_TAGS": cfg.Tags} {
+		if v != GdprKeep && v != GdprDelete {
+			return cfg, fmt.Errorf("invalid %s <%s>, expected %s or %s", name, v, GdprKeep, GdprDelete)
+		}
+	}
+	return cfg, nil
+}
+
+const (
+	OnDeleteCascade  = "cascade"
+	OnDeleteRestrict = "restrict"
+	OnDeleteSetNull  = "set-null"
+)
+
+// OnDeleteConfig decides what happens to ratings, tags and external info referencing a deleted user or movie
+type OnDeleteConfig struct {
+	User  string
+	Movie string
+}
+
+func GetOnDeleteConfig() (OnDeleteConfig, error) {
+	cfg := OnDeleteConfig{
+		User:  viper.GetString("ON_DELETE_USER"),
+		Movie: viper.GetString("ON_DELETE_MOVIE"),
+	}
+	for name, v := range map[string]string{"ON_DELETE_USER": cfg.User, "ON_DELETE_MOVIE": cfg.Movie} {
+		if v != OnDeleteCascade && v != OnDeleteRestrict && v != OnDeleteSetNull {
+			return cfg, fmt.Errorf("invalid %s <%s>, expected %s, %s or %s", name, v, OnDeleteCascade, OnDeleteRestrict, OnDeleteSetNull)
+		}
+	}
+	return cfg, nil
+}
+
+// GetRequireIfMatch returns whether changes of objects must carry If-Match header with their ETag
+func GetRequireIfMatch() bool {
+	return viper.GetBool("REQUIRE_IF_MATCH")
+}
+
+// PurgeConfig controls permanent deletion of soft deleted objects
+type PurgeConfig struct {
+	// Retention is how long soft deleted objects can be restored
+	Retention time.Duration
+	// Interval of scheduled purge, zero disables the schedule
+	Interval time.Duration
+}
+
+func GetPurgeConfig() PurgeConfig {
+	return PurgeConfig{
+		Retention: viper.GetDuration("PURGE_RETENTION"),
+		Interval:  viper.GetDuration("PURGE_INTERVAL"),
+	}
+}
+
+// GetEncryptionKeysFile returns path of the keys file used to encrypt user PII, empty disables encryption
+func GetEncryptionKeysFile() string {
+	return viper.GetString("ENCRYPTION_KEYS_FILE")
+}
+
+// defaultGenres joins genres of MovieLens, IMDb and TMDb
+var defaultGenres = []string{
+	"(no genres listed)", "Action", "Adult", "Adventure", "Animation", "Biography", "Children", "Comedy",
+	"Crime", "Documentary", "Drama", "Family", "Fantasy", "Film-Noir", "Game-Show", "History", "Horror",
+	"IMAX", "Music", "Musical", "Mystery", "News", "Reality-TV", "Romance", "Sci-Fi", "Science Fiction",
+	"Short", "Sport", "Talk-Show", "Thriller", "TV Movie", "War", "Western",
+}
+
+// GetGenreVocabulary returns genres accepted in movies and external info
+func GetGenreVocabulary() []string {
+	return strings.Split(viper.GetString("GENRE_VOCABULARY"), ",")
+}
+
+type LoggingConfig struct {
+	Level string
+	// Format is json or text
+	Format string
+	// RedactFields lists field names whose values are masked in logs and logged payloads
+	RedactFields []string
+}
+
+func GetLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		Level:        viper.GetString("LOG_LEVEL"),
+		Format:       viper.GetString("LOG_FORMAT"),
+		RedactFields: strings.Split(viper.GetString("LOG_REDACT_FIELDS"), ","),
+	}
+}
+
+// GetDbDriver returns name of the GORM dialect to use: postgres, mysql or sqlite
+func GetDbDriver() string {
+	return viper.GetString("DB_DRIVER")
+}
+
 func GetDbConnectionString() string {
 	user := viper.GetString("POSTGRES_USER")
 	pwd := viper.GetString("POSTGRES_PASSWORD")
@@ -32,3 +419,80 @@ func GetDbConnectionString() string {
 	db := viper.GetString("POSTGRES_DB")
 	return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s", user, pwd, host, port, db)
 }
+
+func GetMysqlConnectionString() string {
+	user := viper.GetString("MYSQL_USER")
+	pwd := viper.GetString("MYSQL_PASSWORD")
+	host := viper.GetString("MYSQL_HOST")
+	port := viper.GetInt("MYSQL_PORT")
+	db := viper.GetString("MYSQL_DB")
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=UTC", user, pwd, host, port, db)
+}
+
+func GetSqlitePath() string {
+	return viper.GetString("SQLITE_PATH")
+}
+
+// GetDbAutoMigrate tells whether database schema is migrated on startup
+func GetDbAutoMigrate() bool {
+	return viper.GetBool("DB_AUTO_MIGRATE")
+}
+
+// GetRequestTimeout returns deadline applied to every API request, zero disables it
+func GetRequestTimeout() time.Duration {
+	return viper.GetDuration("REQUEST_TIMEOUT")
+}
+
+type DbPoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout limits duration of a single query, zero disables the limit
+	StatementTimeout time.Duration
+}
+
+func GetDbPoolConfig() DbPoolConfig {
+	return DbPoolConfig{
+		MaxOpenConns:     viper.GetInt("DB_MAX_OPEN_CONNS"),
+		MaxIdleConns:     viper.GetInt("DB_MAX_IDLE_CONNS"),
+		ConnMaxLifetime:  viper.GetDuration("DB_CONN_MAX_LIFETIME"),
+		ConnMaxIdleTime:  viper.GetDuration("DB_CONN_MAX_IDLE_TIME"),
+		StatementTimeout: viper.GetDuration("DB_STATEMENT_TIMEOUT"),
+	}
+}
+
+type DbConnectRetryConfig struct {
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func GetDbConnectRetryConfig() DbConnectRetryConfig {
+	return DbConnectRetryConfig{
+		Retries:    viper.GetInt("DB_CONNECT_RETRIES"),
+		Backoff:    viper.GetDuration("DB_CONNECT_BACKOFF"),
+		MaxBackoff: viper.GetDuration("DB_CONNECT_MAX_BACKOFF"),
+	}
+}
+
+type TracingConfig struct {
+	// Exporter is one of none, otlp, stdout or file
+	Exporter     string
+	ServiceName  string
+	OtlpEndpoint string
+	OtlpInsecure bool
+	FilePath     string
+	SampleRatio  float64
+}
+
+func GetTracingConfig() TracingConfig {
+	return TracingConfig{
+		Exporter:     viper.GetString("TRACING_EXPORTER"),
+		ServiceName:  viper.GetString("TRACING_SERVICE_NAME"),
+		OtlpEndpoint: viper.GetString("TRACING_OTLP_ENDPOINT"),
+		OtlpInsecure: viper.GetBool("TRACING_OTLP_INSECURE"),
+		FilePath:     viper.GetString("TRACING_FILE_PATH"),
+		SampleRatio:  viper.GetFloat64("TRACING_SAMPLE_RATIO"),
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/service/api/auth"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ApiKey struct {
+	ID         uint        `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
+	Name       string      `gorm:"size:128" form:"name" json:"name" xml:"name" binding:"required"`
+	Prefix     string      `gorm:"size:12" json:"prefix" xml:"prefix" swaggerignore:"true"`
+	KeyHash    string      `gorm:"size:64;uniqueIndex" json:"-" swaggerignore:"true"`
+	Scopes     StringArray `gorm:"size:16" form:"scopes" json:"scopes" xml:"scopes" binding:"required" swaggertype:"array,string"`
+	CreatedAt  time.Time   `json:"created_at" xml:"created_at" swaggerignore:"true"`
+	LastUsedAt *time.Time  `json:"last_used_at" xml:"last_used_at" swaggerignore:"true"`
+}
+
+// ApiKeyStore looks up API keys for auth.ApiKeyAuthenticator
+type ApiKeyStore struct{}
+
+func (ApiKeyStore) FindApiKey(ctx context.Context, hash string) (*auth.Principal, error) {
+	db, err := get_db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var key ApiKey
+	result := db.Where("key_hash = ?", hash).First(&key)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if result.Error != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	now := time.Now().UTC()
+	db.Model(&key).UpdateColumn("last_used_at", now)
+
+	return &auth.Principal{ID: "api_key:" + strconv.Itoa(int(key.ID)), Kind: auth.KindApiKey, Scopes: key.Scopes}, nil
+}
+
+func listApiKeys(ctx context.Context) ([]ApiKey, error) {
+	db, err := get_db(ctx)
+
+	var keys []ApiKey
+
+	if err != nil {
+		return keys, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Find(&keys)
+
+	if result.Error != nil {
+		return keys, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	return keys, nil
+}
+
+// addApiKey stores key and returns its plaintext value, which is not recoverable afterwards
+func addApiKey(ctx context.Context, k *ApiKey) (string, error) {
+	for _, s := range k.Scopes {
+		if !auth.ValidScope(s) {
+			return "", &QueryConditionError{Message: fmt.Sprintf("unknown scope <%s>", s)}
+		}
+	}
+
+	db, err := get_db(ctx)
+
+	if err != nil {
+		return "", &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	key, err := auth.GenerateApiKey()
+	if err != nil {
+		return "", &InternalError{Message: fmt.Sprintf("can't generate api key: %s", err.Error())}
+	}
+	k.KeyHash = auth.HashApiKey(key)
+	k.Prefix = key[:12]
+
+	result := db.Create(k)
+
+	if result.Error != nil {
+		return "", &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	}
+
+	log.WithContext(ctx).Info("Insert ApiKey with id: <" + strconv.Itoa(int(k.ID)) + ">")
+
+	return key, nil
+}
+
+func deleteApiKey(ctx context.Context, id int) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Delete(&ApiKey{}, id)
+
+	if result.Error != nil {
+		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
+	}
+
+	return nil
+}
+
+// Get api keys
+// @Summary Get API keys
+// @Description Get list of all API keys, key values are never returned
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /admin/api_keys [get]
+func ListApiKeysHandler(g *gin.Context) {
+	keys, err := listApiKeys(g.Request.Context())
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+	g.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// Add api key
+// @Summary Add API key
+// @Description Creates API key with scopes read, write or admin. Key value is returned only once.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param api_key body db.ApiKey true "api key info"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /admin/api_keys [post]
+func AddApiKeyHandler(g *gin.Context) {
+	var json ApiKey
+
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	key, err := addApiKey(g.Request.Context(), &json)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"status": "api key is created", "api_key": json, "key": key})
+}
+
+// Delete api key
+// @Summary Delete API key
+// @Description Revokes API key by id
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path integer true "api key id"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /admin/api_keys/{id} [delete]
+func DeleteApiKeyHandler(g *gin.Context) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = deleteApiKey(g.Request.Context(), id)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"status": "api key is deleted"})
+}
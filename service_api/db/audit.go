@@ -0,0 +1,367 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"example/service/api/auth"
+	"example/service/api/config"
+	"example/service/api/logging"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditSystemActor is recorded for changes made outside of API requests
+const auditSystemActor = "system"
+
+var errAuditAppendOnly = errors.New("audit log is append-only")
+
+// FieldChange holds old and new value of a field, Old is absent for created objects and New for deleted ones
+type FieldChange struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// AuditDiff maps json field names to their changes, it's stored as JSON
+type AuditDiff map[string]FieldChange
+
+func (AuditDiff) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case config.DbDriverPostgres:
+		return "jsonb"
+	case config.DbDriverMysql:
+		return "JSON"
+	default:
+		return "text"
+	}
+}
+
+func (d AuditDiff) Value() (driver.Value, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (d *AuditDiff) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	default:
+		return fmt.Errorf("can't scan %T into AuditDiff", src)
+	}
+}
+
+// AuditEntry records a single mutation, entries are never updated or deleted
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id" xml:"id"`
+	Timestamp time.Time `gorm:"column:recorded_at;index" json:"timestamp" xml:"timestamp"`
+	Actor     string    `gorm:"size:255;index" json:"actor" xml:"actor"`
+	ActorKind string    `gorm:"size:16" json:"actor_kind" xml:"actor_kind"`
+	RequestID string    `gorm:"size:64;index" json:"request_id" xml:"request_id"`
+	Entity    string    `gorm:"size:32;index:idx_audit_entries_entity" json:"entity" xml:"entity"`
+	EntityID  uint      `gorm:"index:idx_audit_entries_entity" json:"entity_id" xml:"entity_id"`
+	Action    string    `gorm:"size:16" json:"action" xml:"action"`
+	Diff      AuditDiff `json:"diff" xml:"-"`
+}
+
+func (*AuditEntry) BeforeUpdate(*gorm.DB) error {
+	return errAuditAppendOnly
+}
+
+func (*AuditEntry) BeforeDelete(*gorm.DB) error {
+	return errAuditAppendOnly
+}
+
+func toFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return map[string]interface{}{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diffFields compares json representations of old and new, PII values of users are redacted
+func diffFields(entity string, old, new interface{}) (AuditDiff, error) {
+	oldFields, err := toFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := toFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := AuditDiff{}
+	for k, o := range oldFields {
+		if n, ok := newFields[k]; !ok || !reflect.DeepEqual(o, n) {
+			diff[k] = FieldChange{Old: o, New: newFields[k]}
+		}
+	}
+	for k, n := range newFields {
+		if _, ok := oldFields[k]; !ok {
+			diff[k] = FieldChange{New: n}
+		}
+	}
+	delete(diff, "id")
+
+	if entity == auth.ResourceUsers {
+		redactUserDiff(diff)
+	}
+	return diff, nil
+}
+
+// userPIIFields are always redacted in audit diffs of users, audit entries outlive erasure of user data
+var userPIIFields = map[string]bool{"username": true, "name": true, "sex": true, "address": true, "email": true}
+
+// redactUserDiff replaces PII values of user diff, fields of LOG_REDACT_FIELDS are redacted as well
+func redactUserDiff(diff AuditDiff) {
+	for k, c := range diff {
+		if !userPIIFields[k] && !logging.IsRedacted(k) {
+			continue
+		}
+		if c.Old != nil {
+			c.Old = logging.Redacted
+		}
+		if c.New != nil {
+			c.New = logging.Redacted
+		}
+		diff[k] = c
+	}
+}
+
+// scrubUserAudit redacts PII in audit entries of user id written before the redaction rules changed.
+// Erasure is the only change of the audit log, entries are updated by table to bypass append-only hooks.
+func scrubUserAudit(tx *gorm.DB, id uint) error {
+	var entries []AuditEntry
+	if err := tx.Where("entity = ? AND entity_id = ?", auth.ResourceUsers, id).Find(&entries).Error; err != nil {
+		return err
+	}
+	for _, e := range entries {
+		redactUserDiff(e.Diff)
+		err := tx.Table("audit_entries").Where("id = ?", e.ID).UpdateColumn("diff", e.Diff).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newAuditEntry(ctx context.Context, action, entity string, id uint, old, new interface{}) (AuditEntry, error) {
+	diff, err := diffFields(entity, old, new)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("can't compute audit diff: %w", err)
+	}
+
+	entry := AuditEntry{
+		Timestamp: time.Now().UTC(),
+		Actor:     auditSystemActor,
+		RequestID: logging.RequestID(ctx),
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+		Diff:      diff,
+	}
+	if p := auth.FromContext(ctx); p != nil {
+		entry.Actor = p.ID
+		entry.ActorKind = p.Kind
+	}
+	return entry, nil
+}
+
+// audit records mutation of entity object in transaction tx,
+// old is nil for created objects and new is nil for deleted ones
+func audit(tx *gorm.DB, action, entity string, id uint, old, new interface{}) error {
+	entry, err := newAuditEntry(tx.Statement.Context, action, entity, id, old, new)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
+
+// auditCreates records creation of n objects, object returns id and value of i-th one
+func auditCreates(tx *gorm.DB, entity string, n int, object func(i int) (uint, interface{})) error {
+	if n == 0 {
+		return nil
+	}
+	entries := make([]AuditEntry, 0, n)
+	for i := 0; i < n; i++ {
+		id, v := object(i)
+		entry, err := newAuditEntry(tx.Statement.Context, AuditCreate, entity, id, nil, v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return tx.Create(&entries).Error
+}
+
+type AuditFilter struct {
+	Entity    string
+	EntityID  uint
+	Actor     string
+	Action    string
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+	Offset    int
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func listAuditEntries(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	db, err := get_db(ctx)
+
+	entries := []AuditEntry{}
+
+	if err != nil {
+		return entries, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	query := db.Order("id desc").Limit(f.Limit).Offset(f.Offset)
+	if f.Entity != "" {
+		query = query.Where("entity = ?", f.Entity)
+	}
+	if f.EntityID != 0 {
+		query = query.Where("entity_id = ?", f.EntityID)
+	}
+	if f.Actor != "" {
+		query = query.Where("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.RequestID != "" {
+		query = query.Where("request_id = ?", f.RequestID)
+	}
+	if f.From != nil {
+		query = query.Where("recorded_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("recorded_at < ?", *f.To)
+	}
+
+	result := query.Find(&entries)
+
+	if result.Error != nil {
+		return entries, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	return entries, nil
+}
+
+func parseAuditFilter(g *gin.Context) (AuditFilter, error) {
+	f := AuditFilter{
+		Entity:    g.Query("entity"),
+		Actor:     g.Query("actor"),
+		Action:    g.Query("action"),
+		RequestID: g.Query("request_id"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if v := g.Query("entity_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return f, &QueryConditionError{Message: fmt.Sprintf("invalid entity_id <%s>", v)}
+		}
+		f.EntityID = uint(id)
+	}
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if v := g.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, &QueryConditionError{Message: fmt.Sprintf("invalid %s <%s>, RFC 3339 time expected", name, v)}
+			}
+			*dst = &t
+		}
+	}
+	if v := g.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			return f, &QueryConditionError{Message: fmt.Sprintf("invalid limit <%s>, expected 1..%d", v, maxAuditLimit)}
+		}
+		f.Limit = limit
+	}
+	if v := g.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return f, &QueryConditionError{Message: fmt.Sprintf("invalid offset <%s>", v)}
+		}
+		f.Offset = offset
+	}
+
+	return f, nil
+}
+
+// Get audit log
+// @Summary Get audit log
+// @Description Get recorded mutations, newest first
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param entity query string false "entity, e.g. users or movie_tmdb_info"
+// @Param entity_id query integer false "entity id"
+// @Param actor query string false "principal id"
+// @Param action query string false "create, update, delete, restore or purge"
+// @Param request_id query string false "request id"
+// @Param from query string false "RFC 3339 time, inclusive"
+// @Param to query string false "RFC 3339 time, exclusive"
+// @Param limit query integer false "page size, 100 by default"
+// @Param offset query integer false "page offset"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /audit [get]
+func ListAuditEntriesHandler(g *gin.Context) {
+	filter, err := parseAuditFilter(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	entries, err := listAuditEntries(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"audit": entries})
+}
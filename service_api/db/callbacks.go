@@ -0,0 +1,69 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// registerCallbacks instruments every statement with timeout, metrics and tracing.
+// They share one callback pair per processor and are anchored to named built-in callbacks:
+// gorm sorts callbacks with an unstable sort, which reorders built-in callbacks
+// once a processor has more than a dozen of them.
+func registerCallbacks(db *gorm.DB, timeout time.Duration) error {
+	before := func(operation string, limited bool) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			tracingBefore(tx, operation)
+			if limited {
+				statementTimeoutBefore(tx, timeout)
+			}
+			metricsBefore(tx)
+		}
+	}
+
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			metricsAfter(tx, operation)
+			tracingAfter(tx)
+			statementTimeoutAfter(tx)
+		}
+	}
+
+	callbacks := db.Callback()
+
+	if err := callbacks.Create().Before("gorm:begin_transaction").Register("instrumentation:before_create", before("create", true)); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("instrumentation:after_create", after("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("instrumentation:before_query", before("query", true)); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:after_query").Register("instrumentation:after_query", after("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:begin_transaction").Register("instrumentation:before_update", before("update", true)); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("instrumentation:after_update", after("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:begin_transaction").Register("instrumentation:before_delete", before("delete", true)); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("instrumentation:after_delete", after("delete")); err != nil {
+		return err
+	}
+	// rows of Row statements are read after callbacks are finished, so they are not limited by timeout
+	if err := callbacks.Row().Before("gorm:row").Register("instrumentation:before_row", before("row", false)); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("instrumentation:after_row", after("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("instrumentation:before_raw", before("raw", true)); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("instrumentation:after_raw", after("raw"))
+}
@@ -1,42 +1,176 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"example/service/api/config"
 
 	log "github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var _db *gorm.DB
+var (
+	_db    *gorm.DB
+	_db_mu sync.Mutex
+)
+
+func get_dialector() (gorm.Dialector, error) {
+	switch driver := config.GetDbDriver(); driver {
+	case config.DbDriverPostgres:
+		return postgres.Open(config.GetDbConnectionString()), nil
+	case config.DbDriverMysql:
+		return mysql.Open(config.GetMysqlConnectionString()), nil
+	case config.DbDriverSqlite:
+		return sqlite.Open(sqliteDSN(config.GetSqlitePath())), nil
+	default:
+		return nil, &InternalError{Message: fmt.Sprintf("unsupported database driver <%s>", driver)}
+	}
+}
+
+func open_db() (*gorm.DB, error) {
+	dialector, err := get_dialector()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	pool := config.GetDbPoolConfig()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't get database connection pool: %s", err.Error())}
+	}
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	if err := registerCallbacks(db, pool.StatementTimeout); err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't register database callbacks: %s", err.Error())}
+	}
+
+	if err := registerDbStats(db); err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't register database metrics: %s", err.Error())}
+	}
+
+	return db, nil
+}
+
+// get_db returns database handle bound to ctx,
+// cancelling ctx aborts queries executed with this handle
+func get_db(ctx context.Context) (*gorm.DB, error) {
+	_db_mu.Lock()
+	defer _db_mu.Unlock()
 
-func get_db() (*gorm.DB, error) {
 	if _db == nil {
-		db, err := gorm.Open(postgres.Open(config.GetDbConnectionString()), &gorm.Config{})
+		db, err := open_db()
 		if err != nil {
-			return nil, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+			return nil, err
 		}
 		_db = db
 	}
-	return _db, nil
+	return _db.WithContext(ctx), nil
+}
+
+// Connect opens database connection at startup,
+// retrying with exponential backoff while database is not reachable
+func Connect(ctx context.Context) error {
+	retry := config.GetDbConnectRetryConfig()
+	backoff := retry.Backoff
+
+	for attempt := 0; ; attempt++ {
+		_, err := get_db(ctx)
+		if err == nil {
+			log.Info("Database connection established")
+			return nil
+		}
+
+		if attempt >= retry.Retries {
+			return err
+		}
+
+		log.WithFields(log.Fields{"attempt": attempt + 1, "backoff": backoff.String()}).Warn(err)
+
+		select {
+		case <-ctx.Done():
+			return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", ctx.Err().Error())}
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
 }
 
-func Init() error {
-	db, err := get_db()
+func Init(ctx context.Context) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	db.AutoMigrate(
+	onDelete, err := config.GetOnDeleteConfig()
+	if err != nil {
+		return &InternalError{Message: err.Error()}
+	}
+	if err := repairReferences(db, onDelete); err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't migrate database: %s", err.Error())}
+	}
+
+	// rating stats of existing databases are computed once their table is created
+	newRatingStats := !db.Migrator().HasTable(&MovieRatingStats{})
+
+	err = db.AutoMigrate(
 		&Movie{},
+		&MovieRatingStats{},
 		&User{},
 		&Rating{},
 		&Tag{},
 		&MovieImdbInfo{},
 		&MovieTmdbInfo{},
+		&ApiKey{},
+		&AuditEntry{},
+		&MovieRevision{},
+		&MovieImdbInfoRevision{},
+		&MovieTmdbInfoRevision{},
 	)
-	log.Info("Database initialized")
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't migrate database: %s", err.Error())}
+	}
+
+	if err := backfillTimestamps(db); err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't migrate database: %s", err.Error())}
+	}
+
+	if newRatingStats {
+		if _, err := rebuildRatingStats(db); err != nil {
+			return &InternalError{Message: fmt.Sprintf("can't migrate database: %s", err.Error())}
+		}
+	}
+
+	if err := recordSchemaVersion(ctx); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"schema_version": SchemaVersion}).Info("Database initialized")
 	return nil
 }
+
+// sqliteDSN enables foreign key enforcement which SQLite keeps disabled by default
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "?") {
+		return path + "&_foreign_keys=on"
+	}
+	return path + "?_foreign_keys=on"
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"example/service/api/encryption"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer encrypts string fields tagged `gorm:"serializer:encrypted"` with the default keyring.
+// Values are stored as plaintext while encryption is disabled and plaintext values are read as is,
+// so existing rows stay readable until they are re-encrypted.
+type EncryptedSerializer struct{}
+
+func encryptionAAD(field *schema.Field) string {
+	return field.Schema.Table + "." + field.DBName
+}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("can't scan %T into encrypted field %s", dbValue, field.Name)
+	}
+
+	if k := encryption.Default(); k != nil {
+		plaintext, err := k.Decrypt(value, encryptionAAD(field))
+		if err != nil {
+			return fmt.Errorf("can't decrypt field %s: %w", field.Name, err)
+		}
+		value = plaintext
+	} else if encryption.IsEncrypted(value) {
+		return fmt.Errorf("can't decrypt field %s: encryption keys are not configured", field.Name)
+	}
+
+	return field.Set(ctx, dst, value)
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted field %s must be a string, got %T", field.Name, fieldValue)
+	}
+
+	k := encryption.Default()
+	if k == nil || value == "" {
+		return value, nil
+	}
+	return k.Encrypt(value, encryptionAAD(field))
+}
+
+// normalizeEmail is applied to emails before computing blind index, so lookups ignore case and spaces
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailIndex returns blind index of email, empty when encryption is disabled
+func emailIndex(email string) string {
+	k := encryption.Default()
+	if k == nil || email == "" {
+		return ""
+	}
+	return k.BlindIndex(normalizeEmail(email))
+}
+
+// ReencryptUsers rewrites encrypted fields of all users with the active key and recomputes
+// email blind indexes, it's used after key rotation and to encrypt rows written in plaintext
+func ReencryptUsers(ctx context.Context, batchSize int) (int, error) {
+	if encryption.Default() == nil {
+		return 0, fmt.Errorf("encryption keys are not configured")
+	}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return 0, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	count := 0
+	var users []User
+	result := db.Unscoped().FindInBatches(&users, batchSize, func(tx *gorm.DB, batch int) error {
+		for i := range users {
+			users[i].EMailIndex = emailIndex(users[i].EMail)
+			if err := db.Unscoped().Model(&users[i]).Select("address", "e_mail", "e_mail_index").UpdateColumns(&users[i]).Error; err != nil {
+				return err
+			}
+		}
+		count += len(users)
+		log.WithContext(ctx).WithFields(log.Fields{"batch": batch, "users": count}).Info("Re-encrypted users")
+		return nil
+	})
+
+	if result.Error != nil {
+		return count, &InternalError{Message: fmt.Sprintf("can't re-encrypt users: %s", result.Error.Error())}
+	}
+
+	return count, nil
+}
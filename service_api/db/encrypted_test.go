@@ -0,0 +1,125 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example/service/api/encryption"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB replaces database of the package with SQLite database holding tables of models
+func openTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(filepath.Join(t.TempDir(), "test.db"))), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	_db_mu.Lock()
+	_db = db
+	_db_mu.Unlock()
+	t.Cleanup(func() {
+		_db_mu.Lock()
+		_db = nil
+		_db_mu.Unlock()
+	})
+	return db
+}
+
+// initTestKeyring loads keys with given active key id, keys are derived from their ids
+func initTestKeyring(t *testing.T, active string, ids ...string) {
+	keys := map[string]string{}
+	for _, id := range ids {
+		keys[id] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[len(id)-1:]), 32))
+	}
+	data, _ := json.Marshal(map[string]interface{}{"active": active, "keys": keys, "blind_index_key": keys[ids[0]]})
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryption.Init(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedUserFields(t *testing.T) {
+	db := openTestDB(t, &User{})
+	initTestKeyring(t, "k1", "k1")
+
+	user := User{Username: "u1", Name: "N", Sex: "M", Address: "A st", EMail: "A@b.cd"}
+	user.EMailIndex = emailIndex(user.EMail)
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stored struct {
+		Address string
+		EMail   string
+	}
+	db.Table("users").Select("address, e_mail").Where("id = ?", user.ID).Scan(&stored)
+
+	tests := []struct {
+		name      string
+		stored    string
+		plaintext string
+	}{
+		{"address", stored.Address, "A st"},
+		{"email", stored.EMail, "A@b.cd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.HasPrefix(tt.stored, "enc:v1:k1:") || strings.Contains(tt.stored, tt.plaintext) {
+				t.Errorf("stored %s = %s, want value encrypted with k1", tt.name, tt.stored)
+			}
+		})
+	}
+
+	users, err := listUsers(context.Background(), " a@B.cd ", ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].EMail != "A@b.cd" || users[0].Address != "A st" {
+		t.Errorf("listUsers() by email = %+v, want decrypted user", users)
+	}
+}
+
+func TestReencryptUsers(t *testing.T) {
+	db := openTestDB(t, &User{})
+	initTestKeyring(t, "k1", "k1")
+
+	user := User{Username: "u1", Name: "N", Sex: "M", Address: "A st", EMail: "a@b.cd"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// rotation adds new active key, old values stay readable until they're re-encrypted
+	initTestKeyring(t, "k2", "k1", "k2")
+	var read User
+	if err := db.First(&read, user.ID).Error; err != nil || read.EMail != "a@b.cd" {
+		t.Fatalf("user encrypted with old key = %+v, %v", read, err)
+	}
+
+	count, err := ReencryptUsers(context.Background(), 10)
+	if err != nil || count != 1 {
+		t.Fatalf("ReencryptUsers() = %d, %v, want 1 user", count, err)
+	}
+
+	var stored string
+	db.Table("users").Select("e_mail").Where("id = ?", user.ID).Scan(&stored)
+	if !strings.HasPrefix(stored, "enc:v1:k2:") {
+		t.Errorf("re-encrypted email = %s, want value encrypted with k2", stored)
+	}
+	if err := db.First(&read, user.ID).Error; err != nil || read.EMail != "a@b.cd" || read.EMailIndex != emailIndex("a@b.cd") {
+		t.Errorf("re-encrypted user = %+v, %v", read, err)
+	}
+}
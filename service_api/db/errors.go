@@ -1,5 +1,10 @@
 package db
 
+import (
+	"errors"
+	"fmt"
+)
+
 type InternalError struct {
 	Message string
 }
@@ -16,5 +21,48 @@ func (e *QueryConditionError) Error() string {
 	return e.Message
 }
 
+// ReferenceError reports referenced objects which don't exist, Missing maps fields to ids
+type ReferenceError struct {
+	Message string
+	Missing map[string]uint
+}
+
+func (e *ReferenceError) Error() string {
+	return e.Message
+}
+
+// ConstraintError reports operation refused because of references to the object
+type ConstraintError struct {
+	Message string
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Message
+}
+
 var intErr *InternalError
 var qCondErr *QueryConditionError
+var refErr *ReferenceError
+var constraintErr *ConstraintError
+
+// transactionError passes errors meant for the client through and wraps the others as InternalError
+func transactionError(err error, operation string) error {
+	var rErr *ReferenceError
+	var cErr *ConstraintError
+	var pErr *PreconditionError
+	if errors.As(err, &rErr) || errors.As(err, &cErr) || errors.As(err, &pErr) {
+		return err
+	}
+	return &InternalError{Message: fmt.Sprintf("can't perform %s operation: %s", operation, err.Error())}
+}
+
+// PreconditionError reports object changed since the version the client based its request on
+type PreconditionError struct {
+	Message string
+}
+
+func (e *PreconditionError) Error() string {
+	return e.Message
+}
+
+var precondErr *PreconditionError
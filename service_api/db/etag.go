@@ -0,0 +1,61 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example/service/api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag returns entity tag of object version
+func etag(version uint) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// etagMatches reports whether header listing entity tags matches version. With weak comparison
+// weak tags compare equal to strong ones, with strong comparison weak tags never match
+func etagMatches(header string, version uint, weak bool) bool {
+	tag := etag(version)
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch answers 412 and returns false when If-Match header doesn't match object version
+// by strong comparison, so weak tags are rejected, missing header is answered with 428 when preconditions are required
+func checkIfMatch(g *gin.Context, version uint) bool {
+	header := g.GetHeader("If-Match")
+	if header == "" {
+		if config.GetRequireIfMatch() {
+			g.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with object ETag is required"})
+			return false
+		}
+		return true
+	}
+	if !etagMatches(header, version, false) {
+		g.Header("ETag", etag(version))
+		g.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": fmt.Sprintf("object version is %s, it was changed", etag(version))})
+		return false
+	}
+	return true
+}
+
+// writeETag sets ETag of object version and answers 304 returning true when If-None-Match matches it
+func writeETag(g *gin.Context, version uint) bool {
+	g.Header("ETag", etag(version))
+	if header := g.GetHeader("If-None-Match"); header != "" && etagMatches(header, version, true) {
+		g.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"strong tag", `"3"`, false, true},
+		{"other version", `"2"`, false, false},
+		{"list", `"1", "3"`, false, true},
+		{"any", `*`, false, true},
+		{"weak tag by strong comparison", `W/"3"`, false, false},
+		{"weak tag by weak comparison", `W/"3"`, true, true},
+		{"strong tag by weak comparison", `"3"`, true, true},
+		{"unquoted tag", `3`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, 3, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%s, 3, %v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		header   string
+		required bool
+		want     bool
+		status   int
+		wantETag string
+	}{
+		{"no header", "", false, true, http.StatusOK, ""},
+		{"required header", "", true, false, http.StatusPreconditionRequired, ""},
+		{"current version", `"3"`, true, true, http.StatusOK, ""},
+		{"changed object", `"2"`, false, false, http.StatusPreconditionFailed, `"3"`},
+		{"weak tag", `W/"3"`, false, false, http.StatusPreconditionFailed, `"3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("REQUIRE_IF_MATCH", tt.required)
+			defer viper.Set("REQUIRE_IF_MATCH", false)
+
+			w := httptest.NewRecorder()
+			g, _ := gin.CreateTestContext(w)
+			g.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.header != "" {
+				g.Request.Header.Set("If-Match", tt.header)
+			}
+
+			if got := checkIfMatch(g, 3); got != tt.want {
+				t.Errorf("checkIfMatch() = %v, want %v", got, tt.want)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", got, tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestWriteETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"no header", "", false},
+		{"cached version", `"3"`, true},
+		{"weak cached version", `W/"3"`, true},
+		{"stale version", `"2"`, false},
+		{"any", `*`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			g, _ := gin.CreateTestContext(w)
+			g.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				g.Request.Header.Set("If-None-Match", tt.header)
+			}
+
+			if got := writeETag(g, 3); got != tt.want {
+				t.Errorf("writeETag() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("ETag"); got != `"3"` {
+				t.Errorf("ETag = %s, want \"3\"", got)
+			}
+		})
+	}
+}
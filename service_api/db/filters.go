@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TimeRange limits a timestamp column, nil bounds are open
+type TimeRange struct {
+	Column string
+	From   *time.Time
+	To     *time.Time
+}
+
+// ParentFilter limits a list to children of a user or movie
+type ParentFilter struct {
+	Column string
+	ID     uint
+}
+
+// ListFilter narrows down lists of entities
+type ListFilter struct {
+	Times []TimeRange
+	// IncludeDeleted lists soft deleted objects too
+	IncludeDeleted bool
+	Parent         *ParentFilter
+	// Preloads are GORM preloads of included relations
+	Preloads []string
+	// Scopes add conditions specific to an entity
+	Scopes []func(*gorm.DB) *gorm.DB
+	// Order lists ORDER BY expressions, see parseSort
+	Order []string
+	// Limit is a page size, zero lists all objects
+	Limit  int
+	Offset int
+}
+
+const maxListLimit = 1000
+
+// parseIncludeDeleted reads include_deleted query parameter
+func parseIncludeDeleted(g *gin.Context) (bool, error) {
+	v := g.Query("include_deleted")
+	if v == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &QueryConditionError{Message: fmt.Sprintf("invalid include_deleted <%s>, boolean expected", v)}
+	}
+	return include, nil
+}
+
+// withDeleted drops soft delete scope of query when deleted objects are requested
+func withDeleted(query *gorm.DB, include bool) *gorm.DB {
+	if include {
+		return query.Unscoped()
+	}
+	return query
+}
+
+// parseListFilter reads include_deleted, limit, offset and <name>_from and <name>_to query parameters of timestamp columns,
+// name is the column without "_at" suffix, e.g. created_from for created_at
+func parseListFilter(g *gin.Context, timeColumns ...string) (ListFilter, error) {
+	var f ListFilter
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		return f, err
+	}
+	f.IncludeDeleted = includeDeleted
+
+	if g.Query("limit") != "" {
+		if f.Limit, err = parseLimit(g, "limit", 0, maxListLimit); err != nil {
+			return f, err
+		}
+	}
+	if v := g.Query("offset"); v != "" {
+		f.Offset, err = strconv.Atoi(v)
+		if err != nil || f.Offset < 0 {
+			return f, &QueryConditionError{Message: fmt.Sprintf("invalid offset <%s>, non-negative number expected", v)}
+		}
+	}
+
+	for _, column := range timeColumns {
+		r := TimeRange{Column: column}
+		name := strings.TrimSuffix(column, "_at")
+		for param, dst := range map[string]**time.Time{name + "_from": &r.From, name + "_to": &r.To} {
+			if v := g.Query(param); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return f, &QueryConditionError{Message: fmt.Sprintf("invalid %s <%s>, RFC 3339 time expected", param, v)}
+				}
+				*dst = &t
+			}
+		}
+		if r.From != nil || r.To != nil {
+			f.Times = append(f.Times, r)
+		}
+	}
+	return f, nil
+}
+
+func (f ListFilter) apply(query *gorm.DB) *gorm.DB {
+	query = withDeleted(query, f.IncludeDeleted)
+	for _, r := range f.Times {
+		if r.From != nil {
+			query = query.Where(r.Column+" >= ?", *r.From)
+		}
+		if r.To != nil {
+			query = query.Where(r.Column+" < ?", *r.To)
+		}
+	}
+	if f.Parent != nil {
+		query = query.Where(f.Parent.Column+" = ?", f.Parent.ID)
+	}
+	query = preload(query.Scopes(f.Scopes...), f.Preloads)
+	for _, o := range f.Order {
+		query = query.Order(o)
+	}
+	if f.Limit > 0 || f.Offset > 0 {
+		query = query.Order("id").Offset(f.Offset)
+		if f.Limit > 0 {
+			query = query.Limit(f.Limit)
+		}
+	}
+	return query
+}
+
+// parseSort reads sort query parameter, comma separated fields of columns map, which maps sortable fields
+// to their SQL expressions. Fields prefixed with "-" are sorted in descending order, e.g. sort=-avg_rating,name
+func parseSort(g *gin.Context, columns map[string]string) ([]string, error) {
+	var order []string
+	for _, field := range splitList(g.Query("sort")) {
+		direction := " ASC"
+		if strings.HasPrefix(field, "-") {
+			field, direction = field[1:], " DESC"
+		}
+		column, ok := columns[field]
+		if !ok {
+			return nil, &QueryConditionError{Message: fmt.Sprintf("can't sort by <%s>", field)}
+		}
+		order = append(order, column+direction)
+	}
+	return order, nil
+}
+
+// filterByParent limits f to children of parent object given by id path parameter, parent receives the object.
+// Deleted parents are found only when deleted objects are listed.
+func filterByParent(ctx context.Context, id string, parent interface{}, column string, f *ListFilter) error {
+	parentID, err := strconv.Atoi(id)
+	if err != nil {
+		return &QueryConditionError{Message: fmt.Sprintf("invalid id <%s>", id)}
+	}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := withDeleted(db, f.IncludeDeleted).Where("id = ?", parentID).Limit(1).Find(parent)
+
+	if result.Error != nil {
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", parentID)}
+	}
+
+	f.Parent = &ParentFilter{Column: column, ID: uint(parentID)}
+	return nil
+}
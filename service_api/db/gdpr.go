@@ -0,0 +1,302 @@
+package db
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/service/api/auth"
+	"example/service/api/config"
+	notifier "example/service/api/notifier"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// erasedName replaces name and username of erased users
+const erasedName = "erased"
+
+// UserExport is the personal data kept about a user
+type UserExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	User       User      `json:"user"`
+	Ratings    []Rating  `json:"ratings"`
+	Tags       []Tag     `json:"tags"`
+}
+
+// UserErasure is emitted once user data is erased, consumers must purge their copies of the user
+// and of ratings and tags reported as deleted
+type UserErasure struct {
+	UserID           uint      `json:"user_id"`
+	ErasedAt         time.Time `json:"erased_at"`
+	DeletedRatingIDs []uint    `json:"deleted_rating_ids"`
+	DeletedTagIDs    []uint    `json:"deleted_tag_ids"`
+}
+
+// findUser finds user by id, soft deleted users included
+func findUser(db *gorm.DB, id int) (User, error) {
+	var user User
+	result := db.Unscoped().Where("id = ?", id).Limit(1).Find(&user)
+
+	if result.Error != nil {
+		return user, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return user, &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
+	}
+
+	return user, nil
+}
+
+func exportUser(ctx context.Context, id int) (UserExport, error) {
+	export := UserExport{ExportedAt: time.Now().UTC(), Ratings: []Rating{}, Tags: []Tag{}}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return export, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	export.User, err = findUser(db, id)
+	if err != nil {
+		return export, err
+	}
+
+	if err := db.Unscoped().Where("user_id = ?", id).Order("id").Find(&export.Ratings).Error; err != nil {
+		return export, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	if err := db.Unscoped().Where("user_id = ?", id).Order("id").Find(&export.Tags).Error; err != nil {
+		return export, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	return export, nil
+}
+
+// exportArchive packs export into zip archive with a json file per kind of data
+func exportArchive(export UserExport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{"user.json", export.User},
+		{"ratings.json", export.Ratings},
+		{"tags.json", export.Tags},
+		{"manifest.json", gin.H{"user_id": export.User.ID, "exported_at": export.ExportedAt}},
+	}
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// eraseUser anonymizes user PII and, depending on policy, permanently deletes or keeps ratings and tags
+func eraseUser(ctx context.Context, id int, policy config.GdprConfig) (UserErasure, error) {
+	erasure := UserErasure{UserID: uint(id), ErasedAt: time.Now().UTC(), DeletedRatingIDs: []uint{}, DeletedTagIDs: []uint{}}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return erasure, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	user, err := findUser(db, id)
+	if err != nil {
+		return erasure, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		old := user
+		user.Username = erasedName + "-" + strconv.Itoa(id)
+		user.Name = erasedName
+		user.Sex = ""
+		user.Address = ""
+		user.EMail = ""
+		user.EMailIndex = ""
+		user.Version++
+		if err := tx.Unscoped().Model(&user).Select("*").Omit("id").Updates(&user).Error; err != nil {
+			return err
+		}
+		if err := scrubUserAudit(tx, user.ID); err != nil {
+			return err
+		}
+		if err := audit(tx, AuditUpdate, auth.ResourceUsers, user.ID, old, user); err != nil {
+			return err
+		}
+
+		if policy.Ratings == config.GdprDelete {
+			var ratings []Rating
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Find(&ratings).Error; err != nil {
+				return err
+			}
+			for _, r := range ratings {
+				if err := tx.Unscoped().Delete(&r).Error; err != nil {
+					return err
+				}
+				if !r.DeletedAt.Valid {
+					if err := adjustRatingStats(tx, r.MovieID, r.Rating, -1); err != nil {
+						return err
+					}
+				}
+				if err := audit(tx, AuditDelete, auth.ResourceRatings, r.ID, r, nil); err != nil {
+					return err
+				}
+				erasure.DeletedRatingIDs = append(erasure.DeletedRatingIDs, r.ID)
+			}
+		}
+
+		if policy.Tags == config.GdprDelete {
+			var tags []Tag
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Find(&tags).Error; err != nil {
+				return err
+			}
+			for _, t := range tags {
+				if err := tx.Unscoped().Delete(&t).Error; err != nil {
+					return err
+				}
+				if err := audit(tx, AuditDelete, auth.ResourceTags, t.ID, t, nil); err != nil {
+					return err
+				}
+				erasure.DeletedTagIDs = append(erasure.DeletedTagIDs, t.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return erasure, &InternalError{Message: fmt.Sprintf("can't perform erase operation: %s", err.Error())}
+	}
+
+	log.WithContext(ctx).Info("Erase User with id: <" + strconv.Itoa(id) + ">")
+
+	return erasure, nil
+}
+
+// Export user data
+// @Summary Export user data
+// @Description Returns zip archive with the user and all their ratings and tags
+// @Tags users
+// @Produce application/zip
+// @Param id path integer true "user id"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/export [get]
+func ExportUserHandler(g *gin.Context) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireOwner(g, uint(id)) {
+		return
+	}
+
+	export, err := exportUser(g.Request.Context(), id)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	archive, err := exportArchive(export)
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	g.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, id))
+	g.Data(http.StatusOK, "application/zip", archive)
+}
+
+// Erase user data
+// @Summary Erase user data
+// @Description Anonymizes user PII, deletes or keeps ratings and tags according to configured policy and emits UserErasure event
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "user id"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/erase [post]
+func EraseUserHandler(g *gin.Context) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireOwner(g, uint(id)) {
+		return
+	}
+
+	policy, err := config.GetGdprConfig()
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	erasure, err := eraseUser(g.Request.Context(), id, policy)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	notifier.Notify(g.Request.Context(), erasure)
+
+	g.JSON(http.StatusOK, gin.H{"status": "user is erased", "erasure": erasure})
+}
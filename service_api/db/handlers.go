@@ -1,12 +1,84 @@
 package db
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
+	"example/service/api/auth"
+	"example/service/api/config"
+	"example/service/api/logging"
+	"example/service/api/middleware"
+
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
 
+// bindJSON binds request body to obj, normalizes and validates it,
+// on failure the body is logged with PII fields redacted
+func bindJSON(g *gin.Context, obj interface{}) error {
+	err := g.ShouldBindBodyWith(obj, jsonBody{})
+	if err == nil {
+		err = validateBody(obj)
+	}
+	if err != nil {
+		entry := log.WithContext(g.Request.Context())
+		if body, ok := g.Get(gin.BodyBytesKey); ok {
+			entry = entry.WithField("request_body", logging.RedactJSON(body.([]byte)))
+		}
+		entry.Error(err)
+	}
+	return err
+}
+
+// bindErrorStatus returns response status for bindJSON error
+func bindErrorStatus(err error) int {
+	var tooLarge *middleware.BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// bindErrorBody returns response body for bindJSON error, validation errors are reported per field
+func bindErrorBody(err error) gin.H {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return gin.H{"error": "validation failed", "fields": validationErr.Fields}
+	}
+	return gin.H{"error": err.Error()}
+}
+
+// checkBatchSize answers 413 and returns false when batch has more than configured number of objects
+func checkBatchSize(g *gin.Context, size int) bool {
+	max := config.GetMaxBatchSize()
+	if max > 0 && size > max {
+		g.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch of <%d> objects exceeds limit of <%d>", size, max)})
+		return false
+	}
+	return true
+}
+
+// ownerID returns id of the user owning object, zero when object was detached from deleted user
+func ownerID(userID *uint) uint {
+	if userID == nil {
+		return 0
+	}
+	return *userID
+}
+
+// requireOwner answers 403 and returns false when principal may act only on objects
+// of its own user and any of userIDs belongs to another user
+func requireOwner(g *gin.Context, userIDs ...uint) bool {
+	for _, id := range userIDs {
+		if !auth.IsOwner(g, id) {
+			g.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("objects of user <%d> are not accessible to this principal", id)})
+			return false
+		}
+	}
+	return true
+}
+
 // Initialize database
 // @Summary Initialize database
 // @Description initializes database
@@ -15,59 +87,113 @@ import (
 // @Produce json
 // @Success 200
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /db/init_db [post]
 func InitHandler(g *gin.Context) {
-	err := Init()
+	err := Init(g.Request.Context())
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 	g.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
+// AddApiRoutes registers API routes, access to every resource is checked against auth.DefaultPolicy
 func AddApiRoutes(g *gin.RouterGroup) {
-	g.POST("/db/init_db", InitHandler)
+	policy := auth.DefaultPolicy
+
+	g.POST("/db/init_db", auth.Authorize(policy, auth.ResourceDb), InitHandler)
+	g.POST("/db/purge", auth.Authorize(policy, auth.ResourceDb), PurgeHandler)
+	//api keys
+	apiKeys := g.Group("/admin/api_keys", auth.Authorize(policy, auth.ResourceApiKeys))
+	apiKeys.GET("", ListApiKeysHandler)
+	apiKeys.POST("", AddApiKeyHandler)
+	apiKeys.DELETE("/:id", DeleteApiKeyHandler)
+	//audit
+	g.GET("/audit", auth.Authorize(policy, auth.ResourceAudit), ListAuditEntriesHandler)
 	//users
-	g.GET("/users", ListUsersHandler)
-	g.GET("/users/:id", QueryUserHandler)
-	g.POST("/users", AddUserHandler)
-	g.POST("/users/insert_batch", AddUsersHandler)
-	g.PATCH("/users/:id", UpdateUserHandler)
-	g.DELETE("/users/:id", DeleteUserHandler)
+	users := g.Group("/users", auth.Authorize(policy, auth.ResourceUsers))
+	users.GET("", ListUsersHandler)
+	users.GET("/:id", QueryUserHandler)
+	users.POST("", AddUserHandler)
+	users.POST("/insert_batch", AddUsersHandler)
+	users.PATCH("/:id", UpdateUserHandler)
+	users.PUT("/:id", UpdateUserHandler)
+	users.DELETE("/:id", DeleteUserHandler)
+	users.POST("/:id/restore", RestoreUserHandler)
+	users.GET("/:id/stats", QueryUserStatsHandler)
+	// ratings and tags of a user are as public as the other ratings and tags
+	g.GET("/users/:id/ratings", auth.Authorize(policy, auth.ResourceRatings), ListUserRatingsHandler)
+	g.GET("/users/:id/tags", auth.Authorize(policy, auth.ResourceTags), ListUserTagsHandler)
+	g.GET("/users/:id/export", auth.AuthorizeAction(policy, auth.ResourceUsers, auth.ActionExport), ExportUserHandler)
+	g.POST("/users/:id/erase", auth.AuthorizeAction(policy, auth.ResourceUsers, auth.ActionErase), EraseUserHandler)
 	//movies
-	g.GET("/movies", ListMoviesHandler)
-	g.GET("/movies/:id", QueryMovieHandler)
-	g.POST("/movies", AddMovieHandler)
-	g.POST("/movies/insert_batch", AddMoviesHandler)
-	g.PATCH("/movies/:id", UpdateMovieHandler)
-	g.DELETE("/movies/:id", DeleteMovieHandler)
+	movies := g.Group("/movies", auth.Authorize(policy, auth.ResourceMovies))
+	movies.GET("", ListMoviesHandler)
+	movies.GET("/top", TopMoviesHandler)
+	movies.GET("/trending", TrendingMoviesHandler)
+	movies.GET("/:id", QueryMovieHandler)
+	movies.GET("/:id/details", QueryMovieDetailsHandler)
+	movies.GET("/:id/ratings", ListMovieRatingsHandler)
+	movies.GET("/:id/tags", ListMovieTagsHandler)
+	movies.GET("/:id/imdb_info", ListMovieImdbInfoOfMovieHandler)
+	movies.GET("/:id/tmdb_info", ListMovieTmdbInfoOfMovieHandler)
+	movies.POST("", AddMovieHandler)
+	movies.POST("/insert_batch", AddMoviesHandler)
+	movies.PATCH("/:id", UpdateMovieHandler)
+	movies.PUT("/:id", UpdateMovieHandler)
+	movies.DELETE("/:id", DeleteMovieHandler)
+	movies.POST("/:id/restore", RestoreMovieHandler)
+	movies.GET("/:id/revisions", ListMovieRevisionsHandler)
+	movies.GET("/:id/revisions/diff", DiffMovieRevisionsHandler)
+	movies.POST("/:id/revert/:rev", RevertMovieHandler)
 	//ratings
-	g.GET("/ratings", ListRatingsHandler)
-	g.GET("/ratings/:id", QueryRatingHandler)
-	g.POST("/ratings", AddRatingHandler)
-	g.POST("/ratings/insert_batch", AddRatingsHandler)
-	g.PATCH("/ratings/:id", UpdateRatingHandler)
-	g.DELETE("/ratings/:id", DeleteRatingHandler)
+	ratings := g.Group("/ratings", auth.Authorize(policy, auth.ResourceRatings))
+	ratings.GET("", ListRatingsHandler)
+	ratings.GET("/:id", QueryRatingHandler)
+	ratings.POST("", AddRatingHandler)
+	ratings.POST("/insert_batch", AddRatingsHandler)
+	ratings.PATCH("/:id", UpdateRatingHandler)
+	ratings.PUT("/:id", UpdateRatingHandler)
+	ratings.DELETE("/:id", DeleteRatingHandler)
+	ratings.POST("/:id/restore", RestoreRatingHandler)
 	//tags
-	g.GET("/tags", ListTagsHandler)
-	g.GET("/tags/:id", QueryTagHandler)
-	g.POST("/tags", AddTagHandler)
-	g.POST("/tags/insert_batch", AddTagsHandler)
-	g.PATCH("/tags/:id", UpdateTagHandler)
-	g.DELETE("/tags/:id", DeleteTagHandler)
+	tags := g.Group("/tags", auth.Authorize(policy, auth.ResourceTags))
+	tags.GET("", ListTagsHandler)
+	tags.GET("/:id", QueryTagHandler)
+	tags.POST("", AddTagHandler)
+	tags.POST("/insert_batch", AddTagsHandler)
+	tags.PATCH("/:id", UpdateTagHandler)
+	tags.PUT("/:id", UpdateTagHandler)
+	tags.DELETE("/:id", DeleteTagHandler)
+	tags.POST("/:id/restore", RestoreTagHandler)
 	//movie imdb info
-	g.GET("/movie_imdb_info", ListMovieImdbInfoHandler)
-	g.GET("/movie_imdb_info/:id", QueryMovieImdbInfoHandler)
-	g.POST("/movie_imdb_info", AddMovieImdbInfoHandler)
-	g.POST("/movie_imdb_info/insert_batch", AddMovieImdbInfosHandler)
-	g.PATCH("/movie_imdb_info/:id", UpdateMovieImdbInfoHandler)
-	g.DELETE("/movie_imdb_info/:id", DeleteMovieImdbInfoHandler)
+	imdbInfo := g.Group("/movie_imdb_info", auth.Authorize(policy, auth.ResourceMovieImdbInfo))
+	imdbInfo.GET("", ListMovieImdbInfoHandler)
+	imdbInfo.GET("/:id", QueryMovieImdbInfoHandler)
+	imdbInfo.POST("", AddMovieImdbInfoHandler)
+	imdbInfo.POST("/insert_batch", AddMovieImdbInfosHandler)
+	imdbInfo.PATCH("/:id", UpdateMovieImdbInfoHandler)
+	imdbInfo.PUT("/:id", UpdateMovieImdbInfoHandler)
+	imdbInfo.DELETE("/:id", DeleteMovieImdbInfoHandler)
+	imdbInfo.POST("/:id/restore", RestoreMovieImdbInfoHandler)
+	imdbInfo.GET("/:id/revisions", ListMovieImdbInfoRevisionsHandler)
+	imdbInfo.GET("/:id/revisions/diff", DiffMovieImdbInfoRevisionsHandler)
+	imdbInfo.POST("/:id/revert/:rev", RevertMovieImdbInfoHandler)
 	//movie tmdb info
-	g.GET("/movie_tmdb_info", ListMovieTmdbInfoHandler)
-	g.GET("/movie_tmdb_info/:id", QueryMovieTmdbInfoHandler)
-	g.POST("/movie_tmdb_info", AddMovieTmdbInfoHandler)
-	g.POST("/movie_tmdb_info/insert_batch", AddMovieTmdbInfosHandler)
-	g.PATCH("/movie_tmdb_info/:id", UpdateMovieTmdbInfoHandler)
-	g.DELETE("/movie_tmdb_info/:id", DeleteMovieTmdbInfoHandler)
+	tmdbInfo := g.Group("/movie_tmdb_info", auth.Authorize(policy, auth.ResourceMovieTmdbInfo))
+	tmdbInfo.GET("", ListMovieTmdbInfoHandler)
+	tmdbInfo.GET("/:id", QueryMovieTmdbInfoHandler)
+	tmdbInfo.POST("", AddMovieTmdbInfoHandler)
+	tmdbInfo.POST("/insert_batch", AddMovieTmdbInfosHandler)
+	tmdbInfo.PATCH("/:id", UpdateMovieTmdbInfoHandler)
+	tmdbInfo.PUT("/:id", UpdateMovieTmdbInfoHandler)
+	tmdbInfo.DELETE("/:id", DeleteMovieTmdbInfoHandler)
+	tmdbInfo.POST("/:id/restore", RestoreMovieTmdbInfoHandler)
+	tmdbInfo.GET("/:id/revisions", ListMovieTmdbInfoRevisionsHandler)
+	tmdbInfo.GET("/:id/revisions/diff", DiffMovieTmdbInfoRevisionsHandler)
+	tmdbInfo.POST("/:id/revert/:rev", RevertMovieTmdbInfoHandler)
 }
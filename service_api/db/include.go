@@ -0,0 +1,208 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"example/service/api/auth"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// maxIncludeDepth limits nesting of included relations, e.g. movie.imdb_info of a rating
+const maxIncludeDepth = 2
+
+// includeRelation is a GORM association of an entity which may be embedded into responses
+type includeRelation struct {
+	association string
+	entity      string
+	model       interface{}
+}
+
+// includeRelations lists relations by entity and include name
+var includeRelations = map[string]map[string]includeRelation{
+	auth.ResourceRatings: {
+		"user":  {association: "User", entity: auth.ResourceUsers, model: &User{}},
+		"movie": {association: "Movie", entity: auth.ResourceMovies, model: &Movie{}},
+	},
+	auth.ResourceTags: {
+		"user":  {association: "User", entity: auth.ResourceUsers, model: &User{}},
+		"movie": {association: "Movie", entity: auth.ResourceMovies, model: &Movie{}},
+	},
+	auth.ResourceMovies: {
+		"imdb_info": {association: "ImdbInfo", entity: auth.ResourceMovieImdbInfo, model: &MovieImdbInfo{}},
+		"tmdb_info": {association: "TmdbInfo", entity: auth.ResourceMovieTmdbInfo, model: &MovieTmdbInfo{}},
+	},
+	auth.ResourceMovieImdbInfo: {
+		"movie": {association: "Movie", entity: auth.ResourceMovies, model: &Movie{}},
+	},
+	auth.ResourceMovieTmdbInfo: {
+		"movie": {association: "Movie", entity: auth.ResourceMovies, model: &Movie{}},
+	},
+}
+
+// Expansion shapes objects of an entity in responses: included relations are embedded
+// and with a sparse fieldset only listed fields are kept, id is always kept
+type Expansion struct {
+	entity   string
+	model    interface{}
+	preloads []string
+	includes map[string]*Expansion
+	fields   map[string]bool
+	// readable reports whether principal may read user of given id, PII of other users is left out
+	readable func(userID uint) bool
+}
+
+func newExpansion(entity string, model interface{}) *Expansion {
+	return &Expansion{entity: entity, model: model, includes: map[string]*Expansion{}, fields: map[string]bool{}}
+}
+
+// parseExpansion reads include and fields query parameters, both are comma separated lists.
+// Nested relations and their fields are dot separated, e.g. include=movie.imdb_info&fields=rating,movie.name
+func parseExpansion(g *gin.Context, entity string, model interface{}) (*Expansion, error) {
+	e := newExpansion(entity, model)
+	readable := func(userID uint) bool {
+		return auth.Allowed(g, auth.DefaultPolicy, auth.ResourceUsers, auth.ActionRead, userID)
+	}
+
+	for _, path := range splitList(g.Query("include")) {
+		names := strings.Split(path, ".")
+		if len(names) > maxIncludeDepth {
+			return e, &QueryConditionError{Message: fmt.Sprintf("include <%s> is nested deeper than %d", path, maxIncludeDepth)}
+		}
+		node := e
+		associations := make([]string, 0, len(names))
+		for _, name := range names {
+			rel, ok := includeRelations[node.entity][name]
+			if !ok {
+				return e, &QueryConditionError{Message: fmt.Sprintf("can't include <%s>, %s has no such relation", path, node.entity)}
+			}
+			if node.includes[name] == nil {
+				node.includes[name] = newExpansion(rel.entity, rel.model)
+				node.includes[name].readable = readable
+			}
+			node = node.includes[name]
+			associations = append(associations, rel.association)
+		}
+		e.preloads = append(e.preloads, strings.Join(associations, "."))
+		if node.entity == auth.ResourceMovies {
+			e.preloads = append(e.preloads, strings.Join(associations, ".")+".RatingStats")
+		}
+	}
+
+	for _, path := range splitList(g.Query("fields")) {
+		names := strings.Split(path, ".")
+		node := e
+		for _, name := range names[:len(names)-1] {
+			if node.includes[name] == nil {
+				return e, &QueryConditionError{Message: fmt.Sprintf("field <%s> belongs to relation which isn't included", path)}
+			}
+			node = node.includes[name]
+		}
+		field := names[len(names)-1]
+		known, err := toFields(node.model)
+		if err != nil {
+			return e, &InternalError{Message: fmt.Sprintf("can't read fields of %s: %s", node.entity, err.Error())}
+		}
+		if _, ok := known[field]; !ok {
+			return e, &QueryConditionError{Message: fmt.Sprintf("unknown field <%s> of %s", path, node.entity)}
+		}
+		node.fields[field] = true
+	}
+
+	return e, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// empty reports whether objects are returned as they are
+func (e *Expansion) empty() bool {
+	return len(e.includes) == 0 && len(e.fields) == 0
+}
+
+// preload adds preloads of included relations to query
+func preload(query *gorm.DB, preloads []string) *gorm.DB {
+	for _, p := range preloads {
+		query = query.Preload(p)
+	}
+	return query
+}
+
+// render converts object or slice of objects with preloaded relations to their response representation
+func (e *Expansion) render(objects interface{}) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(objects))
+	if v.Kind() != reflect.Slice {
+		return e.object(v)
+	}
+	items := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item, err := e.object(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (e *Expansion) object(v reflect.Value) (interface{}, error) {
+	fields, err := toFields(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	if len(e.fields) > 0 {
+		for k := range fields {
+			if k != "id" && !e.fields[k] {
+				delete(fields, k)
+			}
+		}
+	}
+	if e.entity == auth.ResourceUsers && e.readable != nil && !e.readable(uint(v.FieldByName("ID").Uint())) {
+		for k := range userPIIFields {
+			delete(fields, k)
+		}
+	}
+
+	for name, include := range e.includes {
+		related := v.FieldByName(includeRelations[e.entity][name].association)
+		// related object which isn't found, e.g. soft deleted one, is null
+		if related.Kind() == reflect.Struct && related.FieldByName("ID").Uint() == 0 {
+			fields[name] = nil
+			continue
+		}
+		if fields[name], err = include.render(related.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// writeExpanded answers with objects under key, shaped by expansion
+func writeExpanded(g *gin.Context, key string, e *Expansion, objects interface{}) {
+	if e.empty() {
+		g.JSON(http.StatusOK, gin.H{key: objects})
+		return
+	}
+
+	body, err := e.render(objects)
+	if err != nil {
+		err = &InternalError{Message: fmt.Sprintf("can't render response: %s", err.Error())}
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{key: body})
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"time"
+
+	"example/service/api/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const metricsStartKey = "metrics:start"
+
+// registerDbStats exposes connection pool statistics
+func registerDbStats(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return metrics.RegisterDbStats(collectors.NewDBStatsCollector(sqlDB, db.Dialector.Name()))
+}
+
+func metricsBefore(tx *gorm.DB) {
+	tx.InstanceSet(metricsStartKey, time.Now())
+}
+
+// metricsAfter records duration and errors of statement
+func metricsAfter(tx *gorm.DB, operation string) {
+	start, ok := tx.InstanceGet(metricsStartKey)
+	if !ok {
+		return
+	}
+	table := tx.Statement.Table
+	if table == "" {
+		table = "unknown"
+	}
+	metrics.DbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start.(time.Time)).Seconds())
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		metrics.DbQueryErrors.WithLabelValues(operation, table).Inc()
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SchemaVersion must be incremented on every change of database models
+const SchemaVersion = 11
+
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey" json:"version"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func recordSchemaVersion(ctx context.Context) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't migrate database: %s", err.Error())}
+	}
+
+	m := SchemaMigration{Version: SchemaVersion, AppliedAt: time.Now().UTC()}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&m)
+	if result.Error != nil {
+		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	}
+
+	return nil
+}
+
+// CurrentSchemaVersion returns latest schema version applied to database,
+// zero means database was never initialized
+func CurrentSchemaVersion(ctx context.Context) (uint, error) {
+	db, err := get_db(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+
+	var version uint
+	result := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	if result.Error != nil {
+		return 0, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	return version, nil
+}
+
+// Ping checks that database is reachable
+func Ping(ctx context.Context) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't get database connection pool: %s", err.Error())}
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't ping database: %s", err.Error())}
+	}
+
+	return nil
+}
+
+// backfillTimestamps sets timestamps of rows created before they were managed to the migration time,
+// event times of ratings and tags default to the creation time
+func backfillTimestamps(db *gorm.DB) error {
+	now := db.NowFunc()
+	for _, model := range []interface{}{&Movie{}, &User{}, &Rating{}, &Tag{}, &MovieImdbInfo{}, &MovieTmdbInfo{}} {
+		if err := db.Model(model).Where("created_at IS NULL").UpdateColumn("created_at", now).Error; err != nil {
+			return err
+		}
+		if err := db.Model(model).Where("updated_at IS NULL").UpdateColumn("updated_at", gorm.Expr("created_at")).Error; err != nil {
+			return err
+		}
+	}
+	if err := db.Model(&Rating{}).Where("rated_at IS NULL").UpdateColumn("rated_at", gorm.Expr("created_at")).Error; err != nil {
+		return err
+	}
+	return db.Model(&Tag{}).Where("tagged_at IS NULL").UpdateColumn("tagged_at", gorm.Expr("created_at")).Error
+}
@@ -1,27 +1,77 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
+	"example/service/api/config"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	pq "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Movie struct {
-	ID      uint           `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	Name    string         `form:"name" json:"name" xml:"name" binding:"required"`
-	Imdb_Id uint           `form:"imdb_id" json:"imdb_id" xml:"imdb_id" binding:"required"`
-	Tmdb_Id uint           `form:"tmdb_id" json:"tmdb_id" xml:"tmdb_id" binding:"required"`
-	Genres  pq.StringArray `gorm:"type:varchar(64)[]" form:"genres" json:"genres" xml:"genres" binding:"required" swaggertype:"array,string"`
+	ID      uint        `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
+	Name    string      `form:"name" json:"name" xml:"name" binding:"required,max=512"`
+	Imdb_Id uint        `form:"imdb_id" json:"imdb_id" xml:"imdb_id" binding:"required"`
+	Tmdb_Id uint        `form:"tmdb_id" json:"tmdb_id" xml:"tmdb_id" binding:"required"`
+	Genres  StringArray `gorm:"size:64" form:"genres" json:"genres" xml:"genres" binding:"required,max=32,dive,required,genre" swaggertype:"array,string"`
+	// ImdbInfo and TmdbInfo are loaded only when included, constraints are named as the ones of MovieImdbInfo.Movie
+	// and MovieTmdbInfo.Movie which GORM replaces by these
+	ImdbInfo []MovieImdbInfo `gorm:"foreignKey:MovieId;constraint:fk_movie_imdb_infos_movie,OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" xml:"-" swaggerignore:"true" binding:"-"`
+	TmdbInfo []MovieTmdbInfo `gorm:"foreignKey:MovieId;constraint:fk_movie_tmdb_infos_movie,OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" xml:"-" swaggerignore:"true" binding:"-"`
+	// RatingStats is maintained by the server, it's null until the movie is rated
+	RatingStats *MovieRatingStats `gorm:"foreignKey:MovieID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"rating_stats" xml:"rating_stats" swaggerignore:"true" binding:"-"`
+	CreatedAt   time.Time         `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt   time.Time         `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt   gorm.DeletedAt    `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listMovies() ([]Movie, error) {
-	db, err := get_db()
+// BeforeCreate starts version history, versions sent by clients are ignored
+func (m *Movie) BeforeCreate(tx *gorm.DB) error {
+	m.Version = 1
+	return nil
+}
+
+func (m *Movie) normalize() {
+	m.RatingStats = nil
+	m.Name = strings.TrimSpace(m.Name)
+	m.Genres = canonicalGenres(m.Genres)
+}
+
+// movieSortColumns are sortable fields of movies, movies without ratings have zero rating stats
+var movieSortColumns = map[string]string{
+	"id":         "movies.id",
+	"name":       "movies.name",
+	"created_at": "movies.created_at",
+	"updated_at": "movies.updated_at",
+	"avg_rating": "COALESCE(movie_rating_stats.avg_rating, 0)",
+	"vote_count": "COALESCE(movie_rating_stats.vote_count, 0)",
+}
+
+// withRatingStats joins rating stats of movies, so they can be sorted, and keeps movies rated at least minVotes times
+func withRatingStats(minVotes int64) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		query = query.Joins("LEFT JOIN movie_rating_stats ON movie_rating_stats.movie_id = movies.id")
+		if minVotes > 0 {
+			query = query.Where("COALESCE(movie_rating_stats.vote_count, 0) >= ?", minVotes)
+		}
+		return query
+	}
+}
+
+func listMovies(ctx context.Context, f ListFilter) ([]Movie, error) {
+	db, err := get_db(ctx)
 
 	var movies []Movie
 
@@ -29,43 +79,60 @@ func listMovies() ([]Movie, error) {
 		return movies, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&movies)
+	result := f.apply(db.Preload("RatingStats")).Find(&movies)
 
 	if result.Error != nil {
-		return movies, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return movies, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return movies, nil
 }
 
-func addMovie(m *Movie) error {
-	db, err := get_db()
+func addMovie(ctx context.Context, m *Movie) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(m)
-
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, AuditCreate, auth.ResourceMovies, m.ID, m); err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceMovies, m.ID, nil, m)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert Movie with id: <" + strconv.Itoa(int(m.ID)) + ">")
+	log.WithContext(ctx).Info("Insert Movie with id: <" + strconv.Itoa(int(m.ID)) + ">")
 
 	return nil
 }
 
-func addMovies(movies []Movie) error {
-	db, err := get_db()
+func addMovies(ctx context.Context, movies []Movie) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(movies)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(movies).Error; err != nil {
+			return err
+		}
+		for i := range movies {
+			if err := recordRevision(tx, AuditCreate, auth.ResourceMovies, movies[i].ID, &movies[i]); err != nil {
+				return err
+			}
+		}
+		return auditCreates(tx, auth.ResourceMovies, len(movies), func(i int) (uint, interface{}) { return movies[i].ID, movies[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -74,20 +141,20 @@ func addMovies(movies []Movie) error {
 		t = t + strconv.Itoa(int(m.ID)) + ";"
 	}
 
-	log.Info("Insert Movies with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert Movies with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryMovie(id int) (Movie, error) {
-	db, err := get_db()
+func queryMovie(ctx context.Context, id int, includeDeleted bool, preloads ...string) (Movie, error) {
+	db, err := get_db(ctx)
 	var movie Movie
 
 	if err != nil {
 		return movie, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&movie)
+	result := preload(withDeleted(db, includeDeleted).Preload("RatingStats"), preloads).Where("id = ?", id).Limit(1).Find(&movie)
 
 	if result.Error != nil {
 		return movie, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -100,15 +167,16 @@ func queryMovie(id int) (Movie, error) {
 	return movie, nil
 }
 
-func updateMovie(id int, movie *Movie) error {
-	db, err := get_db()
+// updateMovie saves movie expecting object version, action is recorded in revision history
+func updateMovie(ctx context.Context, id int, movie *Movie, version uint, action string) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
 	var data Movie
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -118,31 +186,85 @@ func updateMovie(id int, movie *Movie) error {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
-	result = db.Model(&data).Select("*").Omit("id").Updates(movie)
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := recordRevision(tx, RevisionBaseline, auth.ResourceMovies, data.ID, &old); err != nil {
+			return err
+		}
+		movie.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at", clause.Associations).Updates(movie)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		movie.ID = data.ID
+		movie.CreatedAt = data.CreatedAt
+		movie.UpdatedAt = data.UpdatedAt
+		if err := recordRevision(tx, action, auth.ResourceMovies, data.ID, movie); err != nil {
+			return err
+		}
+		return audit(tx, AuditUpdate, auth.ResourceMovies, data.ID, old, movie)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteMovie(id int) error {
-	db, err := get_db()
+func deleteMovie(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&Movie{}, id)
+	var data Movie
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	onDelete, err := config.GetOnDeleteConfig()
+	if err != nil {
+		return &InternalError{Message: err.Error()}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := applyOnDelete(tx, onDelete.Movie, auth.ResourceMovies, data.ID, movieChildren); err != nil {
+			return err
+		}
+		old := data
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		if err := recordDeletion(tx, auth.ResourceMovies, data.ID, &old); err != nil {
+			return err
+		}
+		return audit(tx, AuditDelete, auth.ResourceMovies, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
@@ -152,19 +274,63 @@ func deleteMovie(id int) error {
 // @Tags movies
 // @Accept json
 // @Produce json
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. imdb_info,tmdb_info"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param sort query string false "comma separated sort fields, \"-\" prefix sorts descending: id, name, created_at, updated_at, avg_rating, vote_count"
+// @Param min_votes query integer false "minimal number of ratings"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies [get]
 func ListMoviesHandler(g *gin.Context) {
-	movies, err := listMovies()
+	filter, err := parseListFilter(g, "created_at", "updated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovies, &Movie{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	filter.Order, err = parseSort(g, movieSortColumns)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	var minVotes int64
+	if v := g.Query("min_votes"); v != "" {
+		minVotes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || minVotes < 0 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid min_votes <%s>, non-negative number expected", v)})
+			return
+		}
+	}
+	if len(filter.Order) > 0 || minVotes > 0 {
+		filter.Scopes = append(filter.Scopes, withRatingStats(minVotes))
+	}
+
+	movies, err := listMovies(g.Request.Context(), filter)
 
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movies": movies})
+	writeExpanded(g, "movies", expansion, movies)
 }
 
 // Add movie
@@ -177,32 +343,35 @@ func ListMoviesHandler(g *gin.Context) {
 // @Success 200
 // @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies [post]
 func AddMovieHandler(g *gin.Context) {
 	var json Movie
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addMovie(&json)
+	err := addMovie(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie is created", "movie": json})
 }
@@ -216,35 +385,41 @@ func AddMovieHandler(g *gin.Context) {
 // @Param movies body []db.Movie true "movies info"
 // @Success 200
 // Failure 400
+// @Failure 413
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies/insert_batch [post]
 func AddMoviesHandler(g *gin.Context) {
 	var json []Movie
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	if !checkBatchSize(g, len(json)) {
 		return
 	}
 
-	err := addMovies(json)
+	err := addMovies(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "movies": json})
@@ -257,9 +432,17 @@ func AddMoviesHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param include query string false "comma separated related objects to embed, e.g. imdb_info,tmdb_info"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies/{id} [get]
 func QueryMovieHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -269,24 +452,39 @@ func QueryMovieHandler(g *gin.Context) {
 		return
 	}
 
-	movie, err := queryMovie(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovies, &Movie{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	movie, err := queryMovie(g.Request.Context(), id, includeDeleted, expansion.preloads...)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movie": movie})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, movie.Version) {
+		return
+	}
+
+	writeExpanded(g, "movie", expansion, movie)
 }
 
 // Update movie
@@ -297,10 +495,17 @@ func QueryMovieHandler(g *gin.Context) {
 // @Produce json
 // @Param movie body db.Movie true "movie info"
 // @Param id path integer true "movie id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies/{id} [patch]
+// @Router /movies/{id} [put]
 func UpdateMovieHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -310,28 +515,52 @@ func UpdateMovieHandler(g *gin.Context) {
 
 	var json Movie
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	existing, err := queryMovie(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
 		return
 	}
 
-	err = updateMovie(id, &json)
+	err = updateMovie(g.Request.Context(), id, &json, existing.Version, AuditUpdate)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "sucess"})
 }
 
@@ -342,9 +571,16 @@ func UpdateMovieHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 409
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movies/{id} [delete]
 func DeleteMovieHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -353,18 +589,44 @@ func DeleteMovieHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteMovie(id)
+	existing, err := queryMovie(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteMovie(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &constraintErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusConflict, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -372,3 +634,87 @@ func DeleteMovieHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie is deleted"})
 }
+
+// Restore movie
+// @Summary Restore movie
+// @Description Restores soft deleted movie by id
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/restore [post]
+func RestoreMovieHandler(g *gin.Context) {
+	restoreHandler(g, auth.ResourceMovies, &Movie{}, nil)
+}
+
+// Get movie revisions
+// @Summary Get movie revisions
+// @Description Get snapshots of movie after every change, newest first
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param limit query integer false "number of revisions, 50 by default"
+// @Param offset query integer false "number of skipped revisions"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/revisions [get]
+func ListMovieRevisionsHandler(g *gin.Context) {
+	listRevisionsHandler(g, auth.ResourceMovies)
+}
+
+// Diff movie revisions
+// @Summary Diff movie revisions
+// @Description Get fields changed between two revisions of movie
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param from query integer true "revision to compare"
+// @Param to query integer true "revision to compare with"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/revisions/diff [get]
+func DiffMovieRevisionsHandler(g *gin.Context) {
+	diffRevisionsHandler(g, auth.ResourceMovies)
+}
+
+// Revert movie
+// @Summary Revert movie
+// @Description Replaces movie with its snapshot of given revision, the revert is recorded as new revision
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param rev path integer true "revision number"
+// @Param If-Match header string false "ETag of the movie"
+// @Success 200
+// @Failure 400
+// @Failure 412
+// @Failure 422
+// @Failure 428
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/revert/{rev} [post]
+func RevertMovieHandler(g *gin.Context) {
+	var target Movie
+	revertHandler(g, auth.ResourceMovies, &Movie{}, &target, func(ctx context.Context, id int, version uint) error {
+		return updateMovie(ctx, id, &target, version, RevisionRevert)
+	})
+}
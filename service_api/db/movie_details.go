@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDetailsLimit = 10
+	maxDetailsLimit     = 100
+)
+
+// RatingStats summarizes ratings of a movie, Histogram counts ratings by value from "0.5" to "5.0"
+type RatingStats struct {
+	Count     int64            `json:"count"`
+	Mean      float64          `json:"mean"`
+	Histogram map[string]int64 `json:"histogram"`
+}
+
+// TagCount is number of times a tag was given to a movie
+type TagCount struct {
+	TagText string `json:"tag_text"`
+	Count   int64  `json:"count"`
+}
+
+// MovieDetails is a movie with everything known about it, missing external info is null
+type MovieDetails struct {
+	Movie         Movie          `json:"movie"`
+	ImdbInfo      *MovieImdbInfo `json:"imdb_info"`
+	TmdbInfo      *MovieTmdbInfo `json:"tmdb_info"`
+	RatingStats   RatingStats    `json:"rating_stats"`
+	TopTags       []TagCount     `json:"top_tags"`
+	RecentRatings []Rating       `json:"recent_ratings"`
+}
+
+func queryMovieDetails(ctx context.Context, id int, topTags, recentRatings int) (MovieDetails, error) {
+	var details MovieDetails
+
+	movie, err := queryMovie(ctx, id, false)
+	if err != nil {
+		return details, err
+	}
+	details.Movie = movie
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return details, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	var imdbInfo MovieImdbInfo
+	result := db.Where("movie_id = ?", id).Order("id desc").Limit(1).Find(&imdbInfo)
+	if result.Error != nil {
+		return details, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+	if result.RowsAffected > 0 {
+		details.ImdbInfo = &imdbInfo
+	}
+
+	var tmdbInfo MovieTmdbInfo
+	result = db.Where("movie_id = ?", id).Order("id desc").Limit(1).Find(&tmdbInfo)
+	if result.Error != nil {
+		return details, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+	if result.RowsAffected > 0 {
+		details.TmdbInfo = &tmdbInfo
+	}
+
+	// rating stats are materialized with the movie
+	if s := movie.RatingStats; s != nil {
+		details.RatingStats = RatingStats{Count: s.VoteCount, Mean: s.AvgRating, Histogram: s.Histogram}
+	} else {
+		details.RatingStats.Histogram = map[string]int64{}
+		for i := 0; i < ratingBuckets; i++ {
+			details.RatingStats.Histogram[bucketLabel(i)] = 0
+		}
+	}
+
+	details.TopTags = []TagCount{}
+	err = db.Model(&Tag{}).Select("tag_text, COUNT(*) AS count").Where("movie_id = ?", id).
+		Group("tag_text").Order("count desc, tag_text").Limit(topTags).Scan(&details.TopTags).Error
+	if err != nil {
+		return details, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	details.RecentRatings = []Rating{}
+	err = db.Where("movie_id = ?", id).Order("rated_at desc, id desc").Limit(recentRatings).Find(&details.RecentRatings).Error
+	if err != nil {
+		return details, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	return details, nil
+}
+
+// parseLimit reads positive query parameter not greater than max, def when it's missing
+func parseLimit(g *gin.Context, param string, def, max int) (int, error) {
+	v := g.Query(param)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > max {
+		return 0, &QueryConditionError{Message: fmt.Sprintf("invalid %s <%s>, expected 1..%d", param, v, max)}
+	}
+	return n, nil
+}
+
+// Get movie details
+// @Summary Get movie details
+// @Description Shows movie by id with its IMDb and TMDb info, rating statistics, top tags and recent ratings
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param top_tags query integer false "number of top tags, 10 by default"
+// @Param recent_ratings query integer false "number of recent ratings, 10 by default"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/details [get]
+func QueryMovieDetailsHandler(g *gin.Context) {
+	id, err := strconv.Atoi(g.Param("id"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	topTags, err := parseLimit(g, "top_tags", defaultDetailsLimit, maxDetailsLimit)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	recentRatings, err := parseLimit(g, "recent_ratings", defaultDetailsLimit, maxDetailsLimit)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	details, err := queryMovieDetails(g.Request.Context(), id, topTags, recentRatings)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	g.JSON(http.StatusOK, details)
+}
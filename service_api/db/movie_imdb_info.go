@@ -1,36 +1,61 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	pq "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type MovieImdbInfo struct {
 	ID            uint           `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	MovieId       uint           `form:"movie_id" json:"movie_id" xml:"movie_id"  binding:"required"`
-	Genres        pq.StringArray `gorm:"type:text[]" form:"genres" json:"genres" xml:"genres" binding:"required" swaggertype:"array,string"`
-	OriginalTitle string         `form:"original_title" json:"original_title" xml:"original_title"`
-	Runtimes      pq.StringArray `gorm:"type:text[]" form:"runtimes" json:"runtimes" xml:"runtimes" binding:"required" swaggertype:"array,string"`
-	Countries     pq.StringArray `gorm:"type:text[]" form:"countries" json:"countries" xml:"countries" binding:"required" swaggertype:"array,string"`
-	Rating        float32        `form:"rating" json:"rating" xml:"rating" binding:"required"`
+	MovieId       *uint          `form:"movie_id" json:"movie_id" xml:"movie_id"  binding:"required"`
+	Movie         Movie          `gorm:"foreignKey:MovieId;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
+	Genres        StringArray    `form:"genres" json:"genres" xml:"genres" binding:"required,max=32,dive,required,genre" swaggertype:"array,string"`
+	OriginalTitle string         `form:"original_title" json:"original_title" xml:"original_title" binding:"max=512"`
+	Runtimes      StringArray    `form:"runtimes" json:"runtimes" xml:"runtimes" binding:"required,max=32,dive,required,max=64" swaggertype:"array,string"`
+	Countries     StringArray    `form:"countries" json:"countries" xml:"countries" binding:"required,max=64,dive,required,max=128" swaggertype:"array,string"`
+	Rating        float32        `form:"rating" json:"rating" xml:"rating" binding:"required,min=1,max=10"`
 	Votes         uint           `form:"votes" json:"votes" xml:"votes"  binding:"required"`
-	PlotOutline   string         `gorm:"type:text" form:"plot_outline" json:"plot_outline" xml:"plot_outline"`
-	Languages     pq.StringArray `gorm:"type:text[]" form:"languages" json:"languages" xml:"languages" binding:"required" swaggertype:"array,string"`
-	Year          uint           `form:"year" json:"year" xml:"year"  binding:"required"`
-	Kind          string         `form:"kind" json:"kind" xml:"kind"`
-	Plot          pq.StringArray `gorm:"type:text[]" form:"plot" json:"plot" xml:"plot" binding:"required" swaggertype:"array,string"`
-	Synopsis      pq.StringArray `gorm:"type:text[]" form:"synopsis" json:"synopsis" xml:"synopsis" binding:"required" swaggertype:"array,string"`
+	PlotOutline   string         `gorm:"type:text" form:"plot_outline" json:"plot_outline" xml:"plot_outline" binding:"max=10000"`
+	Languages     StringArray    `form:"languages" json:"languages" xml:"languages" binding:"required,max=64,dive,required,max=128" swaggertype:"array,string"`
+	Year          uint           `form:"year" json:"year" xml:"year"  binding:"required,plausible_year"`
+	Kind          string         `form:"kind" json:"kind" xml:"kind" binding:"max=64"`
+	Plot          StringArray    `form:"plot" json:"plot" xml:"plot" binding:"required,max=64,dive,max=10000" swaggertype:"array,string"`
+	Synopsis      StringArray    `form:"synopsis" json:"synopsis" xml:"synopsis" binding:"required,max=16,dive,max=100000" swaggertype:"array,string"`
+	CreatedAt     time.Time      `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt     time.Time      `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listMovieImdbInfo() ([]MovieImdbInfo, error) {
-	db, err := get_db()
+// BeforeCreate starts version history, versions sent by clients are ignored
+func (i *MovieImdbInfo) BeforeCreate(tx *gorm.DB) error {
+	i.Version = 1
+	return nil
+}
+
+func (i *MovieImdbInfo) normalize() {
+	i.Genres = canonicalGenres(i.Genres)
+	i.OriginalTitle = strings.TrimSpace(i.OriginalTitle)
+	i.Runtimes = trimAll(i.Runtimes)
+	i.Countries = trimAll(i.Countries)
+	i.Languages = trimAll(i.Languages)
+	i.Kind = strings.TrimSpace(i.Kind)
+}
+
+func listMovieImdbInfo(ctx context.Context, f ListFilter) ([]MovieImdbInfo, error) {
+	db, err := get_db(ctx)
 
 	var infos []MovieImdbInfo
 
@@ -38,43 +63,66 @@ func listMovieImdbInfo() ([]MovieImdbInfo, error) {
 		return infos, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&infos)
+	result := f.apply(db).Find(&infos)
 
 	if result.Error != nil {
-		return infos, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return infos, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return infos, nil
 }
 
-func addMovieImdbInfo(i *MovieImdbInfo) error {
-	db, err := get_db()
+func addMovieImdbInfo(ctx context.Context, i *MovieImdbInfo) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(i)
-
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, i); err != nil {
+			return err
+		}
+		if err := tx.Create(i).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, AuditCreate, auth.ResourceMovieImdbInfo, i.ID, i); err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceMovieImdbInfo, i.ID, nil, i)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert MovieImdbInfo with id: <" + strconv.Itoa(int(i.ID)) + ">")
+	log.WithContext(ctx).Info("Insert MovieImdbInfo with id: <" + strconv.Itoa(int(i.ID)) + ">")
 
 	return nil
 }
 
-func addMovieImdbInfos(infos []MovieImdbInfo) error {
-	db, err := get_db()
+func addMovieImdbInfos(ctx context.Context, infos []MovieImdbInfo) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(infos)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, infos); err != nil {
+			return err
+		}
+		if err := tx.Create(infos).Error; err != nil {
+			return err
+		}
+		for i := range infos {
+			if err := recordRevision(tx, AuditCreate, auth.ResourceMovieImdbInfo, infos[i].ID, &infos[i]); err != nil {
+				return err
+			}
+		}
+		return auditCreates(tx, auth.ResourceMovieImdbInfo, len(infos), func(i int) (uint, interface{}) { return infos[i].ID, infos[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -83,20 +131,20 @@ func addMovieImdbInfos(infos []MovieImdbInfo) error {
 		t = t + strconv.Itoa(int(m.ID)) + ";"
 	}
 
-	log.Info("Insert MovieImdbInfos with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert MovieImdbInfos with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryMovieImdbInfo(id int) (MovieImdbInfo, error) {
-	db, err := get_db()
+func queryMovieImdbInfo(ctx context.Context, id int, includeDeleted bool, preloads ...string) (MovieImdbInfo, error) {
+	db, err := get_db(ctx)
 	var info MovieImdbInfo
 
 	if err != nil {
 		return info, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&info)
+	result := preload(withDeleted(db, includeDeleted), preloads).Where("id = ?", id).Limit(1).Find(&info)
 
 	if result.Error != nil {
 		return info, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -109,15 +157,16 @@ func queryMovieImdbInfo(id int) (MovieImdbInfo, error) {
 	return info, nil
 }
 
-func updateMovieImdbInfo(id int, info *MovieImdbInfo) error {
-	db, err := get_db()
+// updateMovieImdbInfo saves info expecting object version, action is recorded in revision history
+func updateMovieImdbInfo(ctx context.Context, id int, info *MovieImdbInfo, version uint, action string) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
 	var data MovieImdbInfo
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -127,31 +176,80 @@ func updateMovieImdbInfo(id int, info *MovieImdbInfo) error {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
-	result = db.Model(&data).Select("*").Omit("id").Updates(info)
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, info); err != nil {
+			return err
+		}
+		if err := recordRevision(tx, RevisionBaseline, auth.ResourceMovieImdbInfo, data.ID, &old); err != nil {
+			return err
+		}
+		info.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at").Updates(info)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		info.ID = data.ID
+		info.CreatedAt = data.CreatedAt
+		info.UpdatedAt = data.UpdatedAt
+		if err := recordRevision(tx, action, auth.ResourceMovieImdbInfo, data.ID, info); err != nil {
+			return err
+		}
+		return audit(tx, AuditUpdate, auth.ResourceMovieImdbInfo, data.ID, old, info)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteMovieImdbInfo(id int) error {
-	db, err := get_db()
+func deleteMovieImdbInfo(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&MovieImdbInfo{}, id)
+	var data MovieImdbInfo
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		old := data
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		if err := recordDeletion(tx, auth.ResourceMovieImdbInfo, data.ID, &old); err != nil {
+			return err
+		}
+		return audit(tx, AuditDelete, auth.ResourceMovieImdbInfo, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
@@ -161,19 +259,44 @@ func deleteMovieImdbInfo(id int) error {
 // @Tags movie_imdb_info
 // @Accept json
 // @Produce json
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info [get]
 func ListMovieImdbInfoHandler(g *gin.Context) {
-	infos, err := listMovieImdbInfo()
+	filter, err := parseListFilter(g, "created_at", "updated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieImdbInfo, &MovieImdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	infos, err := listMovieImdbInfo(g.Request.Context(), filter)
 
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movie_imdb_infos": infos})
+	writeExpanded(g, "movie_imdb_infos", expansion, infos)
 }
 
 // Add movie_imdb_info
@@ -185,33 +308,40 @@ func ListMovieImdbInfoHandler(g *gin.Context) {
 // @Param movie_imdb_info body db.MovieImdbInfo true "movie_imdb_info"
 // @Success 200
 // @Failure 400
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info [post]
 func AddMovieImdbInfoHandler(g *gin.Context) {
 	var json MovieImdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addMovieImdbInfo(&json)
+	err := addMovieImdbInfo(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie_imdb_info is created", "movie_imdb_info": json})
 }
@@ -225,35 +355,45 @@ func AddMovieImdbInfoHandler(g *gin.Context) {
 // @Param movie_imdb_infos body []db.MovieImdbInfo true "movie_imdb_infos"
 // @Success 200
 // Failure 400
+// @Failure 413
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info/insert_batch [post]
 func AddMovieImdbInfosHandler(g *gin.Context) {
 	var json []MovieImdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addMovieImdbInfos(json)
+	if !checkBatchSize(g, len(json)) {
+		return
+	}
+
+	err := addMovieImdbInfos(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "movie_imdb_infos": json})
@@ -266,9 +406,17 @@ func AddMovieImdbInfosHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie_imdb_info id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info/{id} [get]
 func QueryMovieImdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -278,24 +426,39 @@ func QueryMovieImdbInfoHandler(g *gin.Context) {
 		return
 	}
 
-	info, err := queryMovieImdbInfo(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieImdbInfo, &MovieImdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	info, err := queryMovieImdbInfo(g.Request.Context(), id, includeDeleted, expansion.preloads...)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movie_imdb_info": info})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, info.Version) {
+		return
+	}
+
+	writeExpanded(g, "movie_imdb_info", expansion, info)
 }
 
 // Update movie_imdb_info
@@ -306,10 +469,18 @@ func QueryMovieImdbInfoHandler(g *gin.Context) {
 // @Produce json
 // @Param user body db.MovieImdbInfo true "movie_imdb_info"
 // @Param id path integer true "movie_imdb_info id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 422
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info/{id} [patch]
+// @Router /movie_imdb_info/{id} [put]
 func UpdateMovieImdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -319,28 +490,55 @@ func UpdateMovieImdbInfoHandler(g *gin.Context) {
 
 	var json MovieImdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err = updateMovieImdbInfo(id, &json)
+	existing, err := queryMovieImdbInfo(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = updateMovieImdbInfo(g.Request.Context(), id, &json, existing.Version, AuditUpdate)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "sucess"})
 }
 
@@ -351,9 +549,15 @@ func UpdateMovieImdbInfoHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie_imdb_info id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_imdb_info/{id} [delete]
 func DeleteMovieImdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -362,18 +566,41 @@ func DeleteMovieImdbInfoHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteMovieImdbInfo(id)
+	existing, err := queryMovieImdbInfo(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteMovieImdbInfo(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -381,3 +608,150 @@ func DeleteMovieImdbInfoHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie_imdb_info is deleted"})
 }
+
+// Restore movie_imdb_info
+// @Summary Restore movie_imdb_info
+// @Description Restores soft deleted movie_imdb_info by id, the referenced objects must not be deleted
+// @Tags movie_imdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_imdb_info id"
+// @Success 200
+// @Failure 400
+// @Failure 422
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_imdb_info/{id}/restore [post]
+func RestoreMovieImdbInfoHandler(g *gin.Context) {
+	restoreHandler(g, auth.ResourceMovieImdbInfo, &MovieImdbInfo{}, nil)
+}
+
+// Get movie IMDb info revisions
+// @Summary Get movie IMDb info revisions
+// @Description Get snapshots of movie IMDb info after every change, newest first
+// @Tags movie_imdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_imdb_info id"
+// @Param limit query integer false "number of revisions, 50 by default"
+// @Param offset query integer false "number of skipped revisions"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_imdb_info/{id}/revisions [get]
+func ListMovieImdbInfoRevisionsHandler(g *gin.Context) {
+	listRevisionsHandler(g, auth.ResourceMovieImdbInfo)
+}
+
+// Diff movie IMDb info revisions
+// @Summary Diff movie IMDb info revisions
+// @Description Get fields changed between two revisions of movie IMDb info
+// @Tags movie_imdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_imdb_info id"
+// @Param from query integer true "revision to compare"
+// @Param to query integer true "revision to compare with"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_imdb_info/{id}/revisions/diff [get]
+func DiffMovieImdbInfoRevisionsHandler(g *gin.Context) {
+	diffRevisionsHandler(g, auth.ResourceMovieImdbInfo)
+}
+
+// Revert movie IMDb info
+// @Summary Revert movie IMDb info
+// @Description Replaces movie IMDb info with its snapshot of given revision, the revert is recorded as new revision
+// @Tags movie_imdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_imdb_info id"
+// @Param rev path integer true "revision number"
+// @Param If-Match header string false "ETag of the movie IMDb info"
+// @Success 200
+// @Failure 400
+// @Failure 412
+// @Failure 422
+// @Failure 428
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_imdb_info/{id}/revert/{rev} [post]
+func RevertMovieImdbInfoHandler(g *gin.Context) {
+	var target MovieImdbInfo
+	revertHandler(g, auth.ResourceMovieImdbInfo, &MovieImdbInfo{}, &target, func(ctx context.Context, id int, version uint) error {
+		return updateMovieImdbInfo(ctx, id, &target, version, RevisionRevert)
+	})
+}
+
+// Get IMDb info of movie
+// @Summary Get IMDb info of movie
+// @Description Get list of IMDb info of movie specified by id
+// @Tags movie_imdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/imdb_info [get]
+func ListMovieImdbInfoOfMovieHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieImdbInfo, &MovieImdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &Movie{}, "movie_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	infos, err := listMovieImdbInfo(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "movie_imdb_infos", expansion, infos)
+}
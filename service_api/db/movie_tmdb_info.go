@@ -1,37 +1,69 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	pq "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type MovieTmdbInfo struct {
 	ID            uint           `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	MovieId       uint           `form:"movie_id" json:"movie_id" xml:"movie_id"  binding:"required"`
+	MovieId       *uint          `form:"movie_id" json:"movie_id" xml:"movie_id"  binding:"required"`
+	Movie         Movie          `gorm:"foreignKey:MovieId;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
 	Adult         *bool          `form:"adult" json:"adult" xml:"adult"  binding:"required"`
-	Genres        pq.StringArray `gorm:"type:text[]" form:"genres" json:"genres" xml:"genres" binding:"required" swaggertype:"array,string"`
-	HomePage      string         `form:"homepage" json:"homepage" xml:"homepage"`
-	OriginalTitle string         `form:"original_title" json:"original_title" xml:"original_title"`
-	Overview      string         `form:"overview" json:"overview" xml:"overview"`
-	Popularity    float32        `form:"popularity" json:"popularity" xml:"popularity" binding:"required"`
-	Runtime       uint           `form:"runtime" json:"runtime" xml:"runtime" binding:"required"`
-	Tagline       string         `form:"tagline" json:"tagline" xml:"tagline"`
-	Title         string         `form:"title" json:"title" xml:"title"`
-	VoteAverage   float32        `form:"vote_average" json:"vote_average" xml:"vote_average" binding:"required"`
+	Genres        StringArray    `form:"genres" json:"genres" xml:"genres" binding:"required,max=32,dive,required,genre" swaggertype:"array,string"`
+	HomePage      string         `form:"homepage" json:"homepage" xml:"homepage" binding:"omitempty,max=2048,http_url"`
+	OriginalTitle string         `form:"original_title" json:"original_title" xml:"original_title" binding:"max=512"`
+	Overview      string         `form:"overview" json:"overview" xml:"overview" binding:"max=10000"`
+	Popularity    float32        `form:"popularity" json:"popularity" xml:"popularity" binding:"required,min=0"`
+	ReleaseDate   string         `gorm:"size:10;index" form:"release_date" json:"release_date" xml:"release_date" binding:"omitempty,datetime=2006-01-02"`
+	Countries     StringArray    `form:"production_countries" json:"production_countries" xml:"production_countries" binding:"max=64,dive,required,max=128" swaggertype:"array,string"`
+	Languages     StringArray    `form:"spoken_languages" json:"spoken_languages" xml:"spoken_languages" binding:"max=64,dive,required,max=128" swaggertype:"array,string"`
+	Runtime       uint           `form:"runtime" json:"runtime" xml:"runtime" binding:"required,max=6000"`
+	Tagline       string         `form:"tagline" json:"tagline" xml:"tagline" binding:"max=1024"`
+	Title         string         `form:"title" json:"title" xml:"title" binding:"max=512"`
+	VoteAverage   float32        `form:"vote_average" json:"vote_average" xml:"vote_average" binding:"required,min=0,max=10"`
 	VoteCount     uint           `form:"vote_count" json:"vote_count" xml:"vote_count" binding:"required"`
-	Keywords      pq.StringArray `gorm:"type:text[]" form:"keywords" json:"keywords" xml:"keywords" binding:"required" swaggertype:"array,string"`
-	VideoURLs     pq.StringArray `gorm:"type:text[]" form:"video_urls" json:"video_urls" xml:"video_urls" binding:"required" swaggertype:"array,string"`
+	Keywords      StringArray    `form:"keywords" json:"keywords" xml:"keywords" binding:"required,max=256,dive,required,max=128" swaggertype:"array,string"`
+	VideoURLs     StringArray    `form:"video_urls" json:"video_urls" xml:"video_urls" binding:"required,max=64,dive,max=2048,http_url" swaggertype:"array,string"`
+	CreatedAt     time.Time      `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt     time.Time      `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listMovieTmdbInfo() ([]MovieTmdbInfo, error) {
-	db, err := get_db()
+// BeforeCreate starts version history, versions sent by clients are ignored
+func (i *MovieTmdbInfo) BeforeCreate(tx *gorm.DB) error {
+	i.Version = 1
+	return nil
+}
+
+func (i *MovieTmdbInfo) normalize() {
+	i.Genres = canonicalGenres(i.Genres)
+	i.HomePage = strings.TrimSpace(i.HomePage)
+	i.OriginalTitle = strings.TrimSpace(i.OriginalTitle)
+	i.Tagline = strings.TrimSpace(i.Tagline)
+	i.Title = strings.TrimSpace(i.Title)
+	i.Keywords = trimAll(i.Keywords)
+	i.VideoURLs = trimAll(i.VideoURLs)
+	i.ReleaseDate = strings.TrimSpace(i.ReleaseDate)
+	i.Countries = trimAll(i.Countries)
+	i.Languages = trimAll(i.Languages)
+}
+
+func listMovieTmdbInfo(ctx context.Context, f ListFilter) ([]MovieTmdbInfo, error) {
+	db, err := get_db(ctx)
 
 	var infos []MovieTmdbInfo
 
@@ -39,43 +71,66 @@ func listMovieTmdbInfo() ([]MovieTmdbInfo, error) {
 		return infos, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&infos)
+	result := f.apply(db).Find(&infos)
 
 	if result.Error != nil {
-		return infos, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return infos, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return infos, nil
 }
 
-func addMovieTmdbInfo(i *MovieTmdbInfo) error {
-	db, err := get_db()
+func addMovieTmdbInfo(ctx context.Context, i *MovieTmdbInfo) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(i)
-
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, i); err != nil {
+			return err
+		}
+		if err := tx.Create(i).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, AuditCreate, auth.ResourceMovieTmdbInfo, i.ID, i); err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceMovieTmdbInfo, i.ID, nil, i)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert MovieTmdbInfo with id: <" + strconv.Itoa(int(i.ID)) + ">")
+	log.WithContext(ctx).Info("Insert MovieTmdbInfo with id: <" + strconv.Itoa(int(i.ID)) + ">")
 
 	return nil
 }
 
-func addMovieTmdbInfos(infos []MovieTmdbInfo) error {
-	db, err := get_db()
+func addMovieTmdbInfos(ctx context.Context, infos []MovieTmdbInfo) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(infos)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, infos); err != nil {
+			return err
+		}
+		if err := tx.Create(infos).Error; err != nil {
+			return err
+		}
+		for i := range infos {
+			if err := recordRevision(tx, AuditCreate, auth.ResourceMovieTmdbInfo, infos[i].ID, &infos[i]); err != nil {
+				return err
+			}
+		}
+		return auditCreates(tx, auth.ResourceMovieTmdbInfo, len(infos), func(i int) (uint, interface{}) { return infos[i].ID, infos[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -84,20 +139,20 @@ func addMovieTmdbInfos(infos []MovieTmdbInfo) error {
 		t = t + strconv.Itoa(int(m.ID)) + ";"
 	}
 
-	log.Info("Insert MovieTmdbInfos with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert MovieTmdbInfos with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryMovieTmdbInfo(id int) (MovieTmdbInfo, error) {
-	db, err := get_db()
+func queryMovieTmdbInfo(ctx context.Context, id int, includeDeleted bool, preloads ...string) (MovieTmdbInfo, error) {
+	db, err := get_db(ctx)
 	var info MovieTmdbInfo
 
 	if err != nil {
 		return info, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&info)
+	result := preload(withDeleted(db, includeDeleted), preloads).Where("id = ?", id).Limit(1).Find(&info)
 
 	if result.Error != nil {
 		return info, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -110,8 +165,9 @@ func queryMovieTmdbInfo(id int) (MovieTmdbInfo, error) {
 	return info, nil
 }
 
-func updateMovieTmdbInfo(id int, info *MovieTmdbInfo) error {
-	db, err := get_db()
+// updateMovieTmdbInfo saves info expecting object version, action is recorded in revision history
+func updateMovieTmdbInfo(ctx context.Context, id int, info *MovieTmdbInfo, version uint, action string) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
@@ -119,7 +175,7 @@ func updateMovieTmdbInfo(id int, info *MovieTmdbInfo) error {
 
 	var data MovieTmdbInfo
 
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -129,31 +185,80 @@ func updateMovieTmdbInfo(id int, info *MovieTmdbInfo) error {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
-	result = db.Model(&data).Select("*").Omit("id").Updates(info)
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, info); err != nil {
+			return err
+		}
+		if err := recordRevision(tx, RevisionBaseline, auth.ResourceMovieTmdbInfo, data.ID, &old); err != nil {
+			return err
+		}
+		info.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at").Updates(info)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		info.ID = data.ID
+		info.CreatedAt = data.CreatedAt
+		info.UpdatedAt = data.UpdatedAt
+		if err := recordRevision(tx, action, auth.ResourceMovieTmdbInfo, data.ID, info); err != nil {
+			return err
+		}
+		return audit(tx, AuditUpdate, auth.ResourceMovieTmdbInfo, data.ID, old, info)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteMovieTmdbInfo(id int) error {
-	db, err := get_db()
+func deleteMovieTmdbInfo(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&MovieTmdbInfo{}, id)
+	var data MovieTmdbInfo
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		old := data
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		if err := recordDeletion(tx, auth.ResourceMovieTmdbInfo, data.ID, &old); err != nil {
+			return err
+		}
+		return audit(tx, AuditDelete, auth.ResourceMovieTmdbInfo, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
@@ -163,19 +268,44 @@ func deleteMovieTmdbInfo(id int) error {
 // @Tags movie_tmdb_info
 // @Accept json
 // @Produce json
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info [get]
 func ListMovieTmdbInfoHandler(g *gin.Context) {
-	infos, err := listMovieTmdbInfo()
+	filter, err := parseListFilter(g, "created_at", "updated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieTmdbInfo, &MovieTmdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	infos, err := listMovieTmdbInfo(g.Request.Context(), filter)
 
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movie_tmdb_infos": infos})
+	writeExpanded(g, "movie_tmdb_infos", expansion, infos)
 }
 
 // Add movie_tmdb_info
@@ -187,33 +317,40 @@ func ListMovieTmdbInfoHandler(g *gin.Context) {
 // @Param movie_tmdb_info body db.MovieTmdbInfo true "movie_tmdb_info"
 // @Success 200
 // @Failure 400
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info [post]
 func AddMovieTmdbInfoHandler(g *gin.Context) {
 	var json MovieTmdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addMovieTmdbInfo(&json)
+	err := addMovieTmdbInfo(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie_tmdb_info is created", "movie_tmdb_info": json})
 }
@@ -227,35 +364,45 @@ func AddMovieTmdbInfoHandler(g *gin.Context) {
 // @Param movie_tmdb_infos body []db.MovieTmdbInfo true "movie_tmdb_infos"
 // @Success 200
 // Failure 400
+// @Failure 413
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info/insert_batch [post]
 func AddMovieTmdbInfosHandler(g *gin.Context) {
 	var json []MovieTmdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addMovieTmdbInfos(json)
+	if !checkBatchSize(g, len(json)) {
+		return
+	}
+
+	err := addMovieTmdbInfos(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "movie_tmdb_infos": json})
@@ -268,9 +415,17 @@ func AddMovieTmdbInfosHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie_tmdb_info id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info/{id} [get]
 func QueryMovieTmdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -280,24 +435,39 @@ func QueryMovieTmdbInfoHandler(g *gin.Context) {
 		return
 	}
 
-	info, err := queryMovieTmdbInfo(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieTmdbInfo, &MovieTmdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	info, err := queryMovieTmdbInfo(g.Request.Context(), id, includeDeleted, expansion.preloads...)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"movie_tmdb_info": info})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, info.Version) {
+		return
+	}
+
+	writeExpanded(g, "movie_tmdb_info", expansion, info)
 }
 
 // Update movie_tmdb_info
@@ -308,10 +478,18 @@ func QueryMovieTmdbInfoHandler(g *gin.Context) {
 // @Produce json
 // @Param user body db.MovieTmdbInfo true "movie_tmdb_info"
 // @Param id path integer true "movie_tmdb_info id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 422
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info/{id} [patch]
+// @Router /movie_tmdb_info/{id} [put]
 func UpdateMovieTmdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -321,28 +499,55 @@ func UpdateMovieTmdbInfoHandler(g *gin.Context) {
 
 	var json MovieTmdbInfo
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err = updateMovieTmdbInfo(id, &json)
+	existing, err := queryMovieTmdbInfo(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = updateMovieTmdbInfo(g.Request.Context(), id, &json, existing.Version, AuditUpdate)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "sucess"})
 }
 
@@ -353,9 +558,15 @@ func UpdateMovieTmdbInfoHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "movie_tmdb_info id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /movie_tmdb_info/{id} [delete]
 func DeleteMovieTmdbInfoHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -364,18 +575,41 @@ func DeleteMovieTmdbInfoHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteMovieTmdbInfo(id)
+	existing, err := queryMovieTmdbInfo(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteMovieTmdbInfo(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -383,3 +617,150 @@ func DeleteMovieTmdbInfoHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "movie_tmdb_info is deleted"})
 }
+
+// Restore movie_tmdb_info
+// @Summary Restore movie_tmdb_info
+// @Description Restores soft deleted movie_tmdb_info by id, the referenced objects must not be deleted
+// @Tags movie_tmdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_tmdb_info id"
+// @Success 200
+// @Failure 400
+// @Failure 422
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_tmdb_info/{id}/restore [post]
+func RestoreMovieTmdbInfoHandler(g *gin.Context) {
+	restoreHandler(g, auth.ResourceMovieTmdbInfo, &MovieTmdbInfo{}, nil)
+}
+
+// Get movie TMDb info revisions
+// @Summary Get movie TMDb info revisions
+// @Description Get snapshots of movie TMDb info after every change, newest first
+// @Tags movie_tmdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_tmdb_info id"
+// @Param limit query integer false "number of revisions, 50 by default"
+// @Param offset query integer false "number of skipped revisions"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_tmdb_info/{id}/revisions [get]
+func ListMovieTmdbInfoRevisionsHandler(g *gin.Context) {
+	listRevisionsHandler(g, auth.ResourceMovieTmdbInfo)
+}
+
+// Diff movie TMDb info revisions
+// @Summary Diff movie TMDb info revisions
+// @Description Get fields changed between two revisions of movie TMDb info
+// @Tags movie_tmdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_tmdb_info id"
+// @Param from query integer true "revision to compare"
+// @Param to query integer true "revision to compare with"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_tmdb_info/{id}/revisions/diff [get]
+func DiffMovieTmdbInfoRevisionsHandler(g *gin.Context) {
+	diffRevisionsHandler(g, auth.ResourceMovieTmdbInfo)
+}
+
+// Revert movie TMDb info
+// @Summary Revert movie TMDb info
+// @Description Replaces movie TMDb info with its snapshot of given revision, the revert is recorded as new revision
+// @Tags movie_tmdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie_tmdb_info id"
+// @Param rev path integer true "revision number"
+// @Param If-Match header string false "ETag of the movie TMDb info"
+// @Success 200
+// @Failure 400
+// @Failure 412
+// @Failure 422
+// @Failure 428
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movie_tmdb_info/{id}/revert/{rev} [post]
+func RevertMovieTmdbInfoHandler(g *gin.Context) {
+	var target MovieTmdbInfo
+	revertHandler(g, auth.ResourceMovieTmdbInfo, &MovieTmdbInfo{}, &target, func(ctx context.Context, id int, version uint) error {
+		return updateMovieTmdbInfo(ctx, id, &target, version, RevisionRevert)
+	})
+}
+
+// Get TMDb info of movie
+// @Summary Get TMDb info of movie
+// @Description Get list of TMDb info of movie specified by id
+// @Tags movie_tmdb_info
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. movie"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/tmdb_info [get]
+func ListMovieTmdbInfoOfMovieHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceMovieTmdbInfo, &MovieTmdbInfo{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &Movie{}, "movie_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	infos, err := listMovieTmdbInfo(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "movie_tmdb_infos", expansion, infos)
+}
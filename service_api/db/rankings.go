@@ -0,0 +1,343 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRankingLimit = 10
+	maxRankingLimit     = 100
+	// defaultPriorVotes is weight of the global average in Bayesian average, in number of votes
+	defaultPriorVotes = 10
+	// defaultTrendingWindow is period of rating activity ranked by trending movies
+	defaultTrendingWindow = 7 * 24 * time.Hour
+)
+
+// RankingFilter selects movies of rankings, genre is matched with movie genres
+// and year, country and language with IMDb or TMDb info
+type RankingFilter struct {
+	Genre    string
+	YearFrom uint
+	YearTo   uint
+	Country  string
+	Language string
+	MinVotes int64
+	Limit    int
+}
+
+// RankedMovie is a movie at position Rank of a ranking
+type RankedMovie struct {
+	Rank  int     `json:"rank"`
+	Score float64 `json:"score"`
+	// Votes is number of ratings counted by the ranking
+	Votes int64 `json:"votes"`
+	Movie Movie `json:"movie"`
+}
+
+func parseRankingFilter(g *gin.Context) (RankingFilter, error) {
+	f := RankingFilter{
+		Genre:    g.Query("genre"),
+		Country:  g.Query("country"),
+		Language: g.Query("language"),
+	}
+	if f.Genre != "" {
+		f.Genre = canonicalGenres(StringArray{f.Genre})[0]
+	}
+
+	for param, dst := range map[string]*uint{"year_from": &f.YearFrom, "year_to": &f.YearTo} {
+		if v := g.Query(param); v != "" {
+			year, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return f, &QueryConditionError{Message: fmt.Sprintf("invalid %s <%s>, year expected", param, v)}
+			}
+			*dst = uint(year)
+		}
+	}
+
+	if v := g.Query("min_votes"); v != "" {
+		minVotes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || minVotes < 0 {
+			return f, &QueryConditionError{Message: fmt.Sprintf("invalid min_votes <%s>, non-negative number expected", v)}
+		}
+		f.MinVotes = minVotes
+	}
+
+	limit, err := parseLimit(g, "limit", defaultRankingLimit, maxRankingLimit)
+	if err != nil {
+		return f, err
+	}
+	f.Limit = limit
+
+	return f, nil
+}
+
+// apply limits query of movies by filter, except of MinVotes which depends on the ranking.
+// Year, country and language must all match either IMDb or TMDb info of the movie.
+func (f RankingFilter) apply(query *gorm.DB) *gorm.DB {
+	query = query.Where("movies.deleted_at IS NULL")
+	if f.Genre != "" {
+		query = query.Where(arrayContains(query, "movies.genres", f.Genre))
+	}
+
+	if f.YearFrom == 0 && f.YearTo == 0 && f.Country == "" && f.Language == "" {
+		return query
+	}
+
+	imdb := query.Session(&gorm.Session{NewDB: true}).Table("movie_imdb_infos").Select("1").
+		Where("movie_imdb_infos.movie_id = movies.id AND movie_imdb_infos.deleted_at IS NULL")
+	if f.YearFrom > 0 {
+		imdb = imdb.Where("movie_imdb_infos.year >= ?", f.YearFrom)
+	}
+	if f.YearTo > 0 {
+		imdb = imdb.Where("movie_imdb_infos.year <= ?", f.YearTo)
+	}
+	if f.Country != "" {
+		imdb = imdb.Where(arrayContains(query, "movie_imdb_infos.countries", f.Country))
+	}
+	if f.Language != "" {
+		imdb = imdb.Where(arrayContains(query, "movie_imdb_infos.languages", f.Language))
+	}
+
+	tmdb := query.Session(&gorm.Session{NewDB: true}).Table("movie_tmdb_infos").Select("1").
+		Where("movie_tmdb_infos.movie_id = movies.id AND movie_tmdb_infos.deleted_at IS NULL")
+	if f.YearFrom > 0 {
+		tmdb = tmdb.Where("movie_tmdb_infos.release_date >= ?", fmt.Sprintf("%04d-01-01", f.YearFrom))
+	}
+	if f.YearTo > 0 {
+		tmdb = tmdb.Where("movie_tmdb_infos.release_date <= ?", fmt.Sprintf("%04d-12-31", f.YearTo))
+	}
+	if f.YearFrom > 0 || f.YearTo > 0 {
+		tmdb = tmdb.Where("movie_tmdb_infos.release_date <> ''")
+	}
+	if f.Country != "" {
+		tmdb = tmdb.Where(arrayContains(query, "movie_tmdb_infos.countries", f.Country))
+	}
+	if f.Language != "" {
+		tmdb = tmdb.Where(arrayContains(query, "movie_tmdb_infos.languages", f.Language))
+	}
+
+	return query.Where("EXISTS (?) OR EXISTS (?)", imdb, tmdb)
+}
+
+// rankingRow is movie id with its score, movies are loaded after ranking
+type rankingRow struct {
+	MovieID uint
+	Score   float64
+	Votes   int64
+}
+
+// loadRanking loads movies of ranked rows keeping their order
+func loadRanking(db *gorm.DB, rows []rankingRow) ([]RankedMovie, error) {
+	ranking := make([]RankedMovie, 0, len(rows))
+	if len(rows) == 0 {
+		return ranking, nil
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.MovieID)
+	}
+	var movies []Movie
+	if err := db.Preload("RatingStats").Where("id IN ?", ids).Find(&movies).Error; err != nil {
+		return ranking, err
+	}
+	byID := make(map[uint]Movie, len(movies))
+	for _, m := range movies {
+		byID[m.ID] = m
+	}
+
+	for _, r := range rows {
+		m, ok := byID[r.MovieID]
+		if !ok {
+			continue
+		}
+		ranking = append(ranking, RankedMovie{Rank: len(ranking) + 1, Score: r.Score, Votes: r.Votes, Movie: m})
+	}
+	return ranking, nil
+}
+
+// topMovies ranks movies by Bayesian average (v*R + m*C) / (v + m) of their rating stats, where v is number
+// of votes, R average rating, C average rating of all movies and m prior votes. Movies with few votes stay
+// close to the global average. It returns the ranking and the global average.
+func topMovies(ctx context.Context, f RankingFilter, priorVotes float64) ([]RankedMovie, float64, error) {
+	db, err := get_db(ctx)
+	if err != nil {
+		return nil, 0, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	var global struct {
+		Sum   float64
+		Count int64
+	}
+	err = db.Model(&MovieRatingStats{}).Select("COALESCE(SUM(rating_sum), 0) AS sum, COALESCE(SUM(vote_count), 0) AS count").
+		Joins("JOIN movies ON movies.id = movie_rating_stats.movie_id AND movies.deleted_at IS NULL").Scan(&global).Error
+	if err != nil {
+		return nil, 0, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	var globalAvg float64
+	if global.Count > 0 {
+		globalAvg = global.Sum / float64(global.Count)
+	}
+
+	minVotes := f.MinVotes
+	if minVotes < 1 {
+		minVotes = 1
+	}
+	var rows []rankingRow
+	query := db.Table("movies").
+		Select("movies.id AS movie_id, (movie_rating_stats.rating_sum + ?) / (movie_rating_stats.vote_count + ?) AS score, movie_rating_stats.vote_count AS votes", priorVotes*globalAvg, priorVotes).
+		Joins("JOIN movie_rating_stats ON movie_rating_stats.movie_id = movies.id").
+		Where("movie_rating_stats.vote_count >= ?", minVotes)
+	err = f.apply(query).Order("score DESC, votes DESC, movies.id").Limit(f.Limit).Scan(&rows).Error
+	if err != nil {
+		return nil, 0, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	ranking, err := loadRanking(db, rows)
+	if err != nil {
+		return nil, 0, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	return ranking, globalAvg, nil
+}
+
+// trendingMovies ranks movies by number of ratings given in window before now, score is their average
+func trendingMovies(ctx context.Context, f RankingFilter, window time.Duration) ([]RankedMovie, error) {
+	db, err := get_db(ctx)
+	if err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	var rows []rankingRow
+	query := db.Table("movies").
+		Select("movies.id AS movie_id, AVG(ratings.rating) AS score, COUNT(*) AS votes").
+		Joins("JOIN ratings ON ratings.movie_id = movies.id AND ratings.deleted_at IS NULL").
+		Where("ratings.rated_at >= ?", time.Now().UTC().Add(-window))
+	err = f.apply(query).Group("movies.id").Having("COUNT(*) >= ?", f.MinVotes).
+		Order("votes DESC, score DESC, movies.id").Limit(f.Limit).Scan(&rows).Error
+	if err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	ranking, err := loadRanking(db, rows)
+	if err != nil {
+		return nil, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	return ranking, nil
+}
+
+// Get top movies
+// @Summary Get top movies
+// @Description Ranks movies by Bayesian average of their ratings, movies with few votes are pulled to the global average
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param genre query string false "movie genre"
+// @Param year_from query integer false "first release year, from IMDb or TMDb info"
+// @Param year_to query integer false "last release year, from IMDb or TMDb info"
+// @Param country query string false "country, from IMDb or TMDb info"
+// @Param language query string false "language, from IMDb or TMDb info"
+// @Param min_votes query integer false "minimal number of ratings"
+// @Param prior_votes query number false "weight of the global average in votes, 10 by default"
+// @Param limit query integer false "number of movies, 10 by default"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/top [get]
+func TopMoviesHandler(g *gin.Context) {
+	filter, err := parseRankingFilter(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	priorVotes := float64(defaultPriorVotes)
+	if v := g.Query("prior_votes"); v != "" {
+		priorVotes, err = strconv.ParseFloat(v, 64)
+		if err != nil || priorVotes < 0 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid prior_votes <%s>, non-negative number expected", v)})
+			return
+		}
+	}
+
+	ranking, globalAvg, err := topMovies(g.Request.Context(), filter, priorVotes)
+
+	if err != nil {
+		rankingError(g, err)
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"movies": ranking, "global_avg_rating": globalAvg, "prior_votes": priorVotes})
+}
+
+// Get trending movies
+// @Summary Get trending movies
+// @Description Ranks movies by number of ratings given in a sliding window, score is their average rating
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param window query string false "period before now, e.g. 24h, 168h by default"
+// @Param genre query string false "movie genre"
+// @Param year_from query integer false "first release year, from IMDb or TMDb info"
+// @Param year_to query integer false "last release year, from IMDb or TMDb info"
+// @Param country query string false "country, from IMDb or TMDb info"
+// @Param language query string false "language, from IMDb or TMDb info"
+// @Param min_votes query integer false "minimal number of ratings in the window"
+// @Param limit query integer false "number of movies, 10 by default"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/trending [get]
+func TrendingMoviesHandler(g *gin.Context) {
+	filter, err := parseRankingFilter(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	window := defaultTrendingWindow
+	if v := g.Query("window"); v != "" {
+		window, err = time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid window <%s>, positive duration expected", v)})
+			return
+		}
+	}
+
+	ranking, err := trendingMovies(g.Request.Context(), filter, window)
+
+	if err != nil {
+		rankingError(g, err)
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"movies": ranking, "window": window.String()})
+}
+
+func rankingError(g *gin.Context, err error) {
+	switch {
+	case errors.As(err, &intErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	case errors.As(err, &qCondErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+	default:
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	}
+}
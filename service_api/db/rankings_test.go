@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestTopMovies(t *testing.T) {
+	db := openTestDB(t, &Movie{}, &MovieRatingStats{}, &MovieImdbInfo{}, &MovieTmdbInfo{})
+
+	movies := []struct {
+		genre string
+		votes int64
+		sum   float64
+	}{
+		{"Drama", 100, 400},
+		{"Drama", 2, 10},
+		{"Comedy", 50, 150},
+		{"Comedy", 0, 0},
+	}
+	for i, m := range movies {
+		must(t, db.Create(&Movie{Name: "M", Imdb_Id: uint(i + 1), Tmdb_Id: uint(i + 1), Genres: StringArray{m.genre}}).Error)
+		if m.votes > 0 {
+			must(t, db.Create(&MovieRatingStats{MovieID: uint(i + 1), VoteCount: m.votes, RatingSum: m.sum, AvgRating: m.sum / float64(m.votes)}).Error)
+		}
+	}
+	id := func(v uint) *uint { return &v }
+	must(t, db.Create(&MovieImdbInfo{MovieId: id(1), Year: 1999, Countries: StringArray{"UK"}, Languages: StringArray{"English"}}).Error)
+	must(t, db.Create(&MovieTmdbInfo{MovieId: id(3), ReleaseDate: "2005-03-01", Countries: StringArray{"US"}, Languages: StringArray{"French"}}).Error)
+
+	globalAvg := 560.0 / 152
+	score := func(m int, priorVotes float64) float64 {
+		return (movies[m-1].sum + priorVotes*globalAvg) / (float64(movies[m-1].votes) + priorVotes)
+	}
+
+	tests := []struct {
+		name       string
+		filter     RankingFilter
+		priorVotes float64
+		want       []int
+	}{
+		{"few votes are pulled to global average", RankingFilter{}, 10, []int{1, 2, 3}},
+		{"without prior plain average wins", RankingFilter{}, 0, []int{2, 1, 3}},
+		{"minimum votes", RankingFilter{MinVotes: 3}, 0, []int{1, 3}},
+		{"genre", RankingFilter{Genre: "Comedy"}, 10, []int{3}},
+		{"IMDb year", RankingFilter{YearTo: 2000}, 10, []int{1}},
+		{"TMDb release date", RankingFilter{YearFrom: 2000}, 10, []int{3}},
+		{"TMDb country", RankingFilter{Country: "US"}, 10, []int{3}},
+		{"IMDb language", RankingFilter{Language: "English"}, 10, []int{1}},
+		{"year and country of different infos", RankingFilter{YearTo: 2000, Country: "US"}, 10, []int{}},
+		{"limit", RankingFilter{Limit: 1}, 10, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.Limit == 0 {
+				tt.filter.Limit = defaultRankingLimit
+			}
+			ranking, avg, err := topMovies(context.Background(), tt.filter, tt.priorVotes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(avg-globalAvg) > 1e-9 {
+				t.Errorf("global average = %v, want %v", avg, globalAvg)
+			}
+			if len(ranking) != len(tt.want) {
+				t.Fatalf("ranking has %d movies, want %v", len(ranking), tt.want)
+			}
+			for i, m := range tt.want {
+				r := ranking[i]
+				if int(r.Movie.ID) != m || r.Rank != i+1 {
+					t.Errorf("rank %d = movie %d, want %d", r.Rank, r.Movie.ID, m)
+				}
+				if math.Abs(r.Score-score(m, tt.priorVotes)) > 1e-9 {
+					t.Errorf("score of movie %d = %v, want %v", m, r.Score, score(m, tt.priorVotes))
+				}
+				if r.Votes != movies[m-1].votes {
+					t.Errorf("votes of movie %d = %d, want %d", m, r.Votes, movies[m-1].votes)
+				}
+			}
+		})
+	}
+}
@@ -1,27 +1,47 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type Rating struct {
 	ID      uint    `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	UserID  uint    `form:"user_id" json:"user_id" xml:"user_id" binding:"required"`
-	User    User    `gorm:"foreignKey:UserID" json:"-" swaggerignore:"true" binding:"-"`
-	MovieID uint    `form:"movie_id" json:"movie_id" xml:"movie_id" binding:"required"`
-	Movie   Movie   `gorm:"foreignKey:MovieID" json:"-" swaggerignore:"true" binding:"-"`
-	Rating  float32 `form:"rating" json:"rating" xml:"rating" binding:"required"`
+	UserID  *uint   `form:"user_id" json:"user_id" xml:"user_id" binding:"required"`
+	User    User    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
+	MovieID *uint   `form:"movie_id" json:"movie_id" xml:"movie_id" binding:"required"`
+	Movie   Movie   `gorm:"foreignKey:MovieID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
+	Rating  float32 `form:"rating" json:"rating" xml:"rating" binding:"required,min=0.5,max=5,rating_step"`
+	// RatedAt is when the user rated the movie, creation time by default
+	RatedAt   time.Time      `gorm:"index" form:"rated_at" json:"rated_at" xml:"rated_at" binding:"omitempty,past_time"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt time.Time      `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listRatings() ([]Rating, error) {
-	db, err := get_db()
+// BeforeCreate starts version history and defaults RatedAt to creation time
+func (r *Rating) BeforeCreate(tx *gorm.DB) error {
+	r.Version = 1
+	if r.RatedAt.IsZero() {
+		r.RatedAt = tx.Statement.DB.NowFunc()
+	}
+	return nil
+}
+
+func listRatings(ctx context.Context, f ListFilter) ([]Rating, error) {
+	db, err := get_db(ctx)
 
 	var ratings []Rating
 
@@ -29,43 +49,66 @@ func listRatings() ([]Rating, error) {
 		return ratings, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&ratings)
+	result := f.apply(db).Find(&ratings)
 
 	if result.Error != nil {
-		return ratings, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return ratings, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return ratings, nil
 }
 
-func addRating(r *Rating) error {
-	db, err := get_db()
+func addRating(ctx context.Context, r *Rating) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(r)
-
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, r); err != nil {
+			return err
+		}
+		if err := tx.Create(r).Error; err != nil {
+			return err
+		}
+		if err := adjustRatingStats(tx, r.MovieID, r.Rating, 1); err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceRatings, r.ID, nil, r)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert Rating with id: <" + strconv.Itoa(int(r.ID)) + ">")
+	log.WithContext(ctx).Info("Insert Rating with id: <" + strconv.Itoa(int(r.ID)) + ">")
 
 	return nil
 }
 
-func addRatings(ratings []Rating) error {
-	db, err := get_db()
+func addRatings(ctx context.Context, ratings []Rating) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(ratings)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, ratings); err != nil {
+			return err
+		}
+		if err := tx.Create(ratings).Error; err != nil {
+			return err
+		}
+		for _, r := range ratings {
+			if err := adjustRatingStats(tx, r.MovieID, r.Rating, 1); err != nil {
+				return err
+			}
+		}
+		return auditCreates(tx, auth.ResourceRatings, len(ratings), func(i int) (uint, interface{}) { return ratings[i].ID, ratings[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -74,20 +117,20 @@ func addRatings(ratings []Rating) error {
 		t = t + strconv.Itoa(int(m.ID)) + ";"
 	}
 
-	log.Info("Insert Ratings with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert Ratings with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryRating(id int) (Rating, error) {
-	db, err := get_db()
+func queryRating(ctx context.Context, id int, includeDeleted bool, preloads ...string) (Rating, error) {
+	db, err := get_db(ctx)
 	var rating Rating
 
 	if err != nil {
 		return rating, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&rating)
+	result := preload(withDeleted(db, includeDeleted), preloads).Where("id = ?", id).Limit(1).Find(&rating)
 
 	if result.Error != nil {
 		return rating, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -100,15 +143,15 @@ func queryRating(id int) (Rating, error) {
 	return rating, nil
 }
 
-func updateRating(id int, rating *Rating) error {
-	db, err := get_db()
+func updateRating(ctx context.Context, id int, rating *Rating, version uint) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
 	var data Rating
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -118,31 +161,85 @@ func updateRating(id int, rating *Rating) error {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
-	result = db.Model(&data).Select("*").Omit("id").Updates(rating)
+	if rating.RatedAt.IsZero() {
+		rating.RatedAt = data.RatedAt
+	}
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, rating); err != nil {
+			return err
+		}
+		rating.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at").Updates(rating)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		rating.ID = data.ID
+		rating.CreatedAt = data.CreatedAt
+		rating.UpdatedAt = data.UpdatedAt
+		if old.Rating != rating.Rating || !sameID(old.MovieID, rating.MovieID) {
+			if err := adjustRatingStats(tx, old.MovieID, old.Rating, -1); err != nil {
+				return err
+			}
+			if err := adjustRatingStats(tx, rating.MovieID, rating.Rating, 1); err != nil {
+				return err
+			}
+		}
+		return audit(tx, AuditUpdate, auth.ResourceRatings, data.ID, old, rating)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteRating(id int) error {
-	db, err := get_db()
+func deleteRating(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&Rating{}, id)
+	var data Rating
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		if err := adjustRatingStats(tx, data.MovieID, data.Rating, -1); err != nil {
+			return err
+		}
+		return audit(tx, AuditDelete, auth.ResourceRatings, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
@@ -152,19 +249,46 @@ func deleteRating(id int) error {
 // @Tags ratings
 // @Accept json
 // @Produce json
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param rated_from query string false "RFC 3339 time, inclusive lower bound of rated_at"
+// @Param rated_to query string false "RFC 3339 time, exclusive upper bound of rated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.imdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings [get]
 func ListRatingsHandler(g *gin.Context) {
-	ratings, err := listRatings()
+	filter, err := parseListFilter(g, "created_at", "updated_at", "rated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceRatings, &Rating{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	ratings, err := listRatings(g.Request.Context(), filter)
 
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"ratings": ratings})
+	writeExpanded(g, "ratings", expansion, ratings)
 }
 
 // Add rating
@@ -176,33 +300,45 @@ func ListRatingsHandler(g *gin.Context) {
 // @Param rating body db.Rating true "rating info"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings [post]
 func AddRatingHandler(g *gin.Context) {
 	var json Rating
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addRating(&json)
+	if !requireOwner(g, ownerID(json.UserID)) {
+		return
+	}
+
+	err := addRating(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 
 	g.JSON(http.StatusOK, gin.H{"status": "rating is created", "rating": json})
 }
@@ -216,35 +352,51 @@ func AddRatingHandler(g *gin.Context) {
 // @Param ratings body []db.Rating true "ratings info"
 // @Success 200
 // Failure 400
+// @Failure 413
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings/insert_batch [post]
 func AddRatingsHandler(g *gin.Context) {
 	var json []Rating
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	if !checkBatchSize(g, len(json)) {
 		return
 	}
 
-	err := addRatings(json)
+	for _, r := range json {
+		if !requireOwner(g, ownerID(r.UserID)) {
+			return
+		}
+	}
+
+	err := addRatings(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "ratings": json})
@@ -257,9 +409,18 @@ func AddRatingsHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "rating id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.imdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
+// @Failure 403
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings/{id} [get]
 func QueryRatingHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -269,24 +430,39 @@ func QueryRatingHandler(g *gin.Context) {
 		return
 	}
 
-	rating, err := queryRating(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceRatings, &Rating{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	rating, err := queryRating(g.Request.Context(), id, includeDeleted, expansion.preloads...)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"rating": rating})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, rating.Version) {
+		return
+	}
+
+	writeExpanded(g, "rating", expansion, rating)
 }
 
 // Update rating
@@ -297,10 +473,19 @@ func QueryRatingHandler(g *gin.Context) {
 // @Produce json
 // @Param user body db.Rating true "rating info"
 // @Param id path integer true "rating id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 422
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings/{id} [patch]
+// @Router /ratings/{id} [put]
 func UpdateRatingHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -310,28 +495,59 @@ func UpdateRatingHandler(g *gin.Context) {
 
 	var json Rating
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err = updateRating(id, &json)
+	existing, err := queryRating(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !requireOwner(g, ownerID(existing.UserID), ownerID(json.UserID)) {
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = updateRating(g.Request.Context(), id, &json, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "sucess"})
 }
 
@@ -342,9 +558,16 @@ func UpdateRatingHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "rating id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /ratings/{id} [delete]
 func DeleteRatingHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -353,18 +576,45 @@ func DeleteRatingHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteRating(id)
+	existing, err := queryRating(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !requireOwner(g, ownerID(existing.UserID)) {
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteRating(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -372,3 +622,152 @@ func DeleteRatingHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "rating is deleted"})
 }
+
+// Restore rating
+// @Summary Restore rating
+// @Description Restores soft deleted rating by id, the referenced objects must not be deleted
+// @Tags ratings
+// @Accept json
+// @Produce json
+// @Param id path integer true "rating id"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 422
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /ratings/{id}/restore [post]
+func RestoreRatingHandler(g *gin.Context) {
+	var rating Rating
+	restoreHandler(g, auth.ResourceRatings, &rating, func() uint { return ownerID(rating.UserID) })
+}
+
+// Get ratings of user
+// @Summary Get ratings of user
+// @Description Get list of ratings of user specified by id
+// @Tags ratings
+// @Accept json
+// @Produce json
+// @Param id path integer true "user id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param rated_from query string false "RFC 3339 time, inclusive lower bound of rated_at"
+// @Param rated_to query string false "RFC 3339 time, exclusive upper bound of rated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.imdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/ratings [get]
+func ListUserRatingsHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at", "rated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceRatings, &Rating{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &User{}, "user_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	ratings, err := listRatings(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "ratings", expansion, ratings)
+}
+
+// Get ratings of movie
+// @Summary Get ratings of movie
+// @Description Get list of ratings of movie specified by id
+// @Tags ratings
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param rated_from query string false "RFC 3339 time, inclusive lower bound of rated_at"
+// @Param rated_to query string false "RFC 3339 time, exclusive upper bound of rated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.imdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/ratings [get]
+func ListMovieRatingsHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at", "rated_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceRatings, &Rating{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &Movie{}, "movie_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	ratings, err := listRatings(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "ratings", expansion, ratings)
+}
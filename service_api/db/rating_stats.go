@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ratingBuckets is number of possible rating values, ratings are multiples of 0.5 from 0.5 to 5
+const ratingBuckets = 10
+
+// MovieRatingStats is materialized aggregate of movie ratings, it's updated with every rating change
+// and can be recomputed by RebuildRatingStats. Soft deleted ratings aren't counted.
+type MovieRatingStats struct {
+	MovieID   uint    `gorm:"primaryKey;autoIncrement:false" json:"-" xml:"-"`
+	VoteCount int64   `gorm:"not null;default:0;index" json:"vote_count" xml:"vote_count"`
+	RatingSum float64 `gorm:"not null;default:0" json:"-" xml:"-"`
+	AvgRating float64 `gorm:"not null;default:0;index" json:"avg_rating" xml:"avg_rating"`
+	// Votes05 to Votes50 count ratings by value, they're exposed as Histogram
+	Votes05   int64            `gorm:"column:votes_05;not null;default:0" json:"-" xml:"-"`
+	Votes10   int64            `gorm:"column:votes_10;not null;default:0" json:"-" xml:"-"`
+	Votes15   int64            `gorm:"column:votes_15;not null;default:0" json:"-" xml:"-"`
+	Votes20   int64            `gorm:"column:votes_20;not null;default:0" json:"-" xml:"-"`
+	Votes25   int64            `gorm:"column:votes_25;not null;default:0" json:"-" xml:"-"`
+	Votes30   int64            `gorm:"column:votes_30;not null;default:0" json:"-" xml:"-"`
+	Votes35   int64            `gorm:"column:votes_35;not null;default:0" json:"-" xml:"-"`
+	Votes40   int64            `gorm:"column:votes_40;not null;default:0" json:"-" xml:"-"`
+	Votes45   int64            `gorm:"column:votes_45;not null;default:0" json:"-" xml:"-"`
+	Votes50   int64            `gorm:"column:votes_50;not null;default:0" json:"-" xml:"-"`
+	Histogram map[string]int64 `gorm:"-" json:"histogram" xml:"-"`
+}
+
+// AfterFind fills Histogram from the vote columns
+func (s *MovieRatingStats) AfterFind(tx *gorm.DB) error {
+	s.Histogram = map[string]int64{}
+	for i, votes := range s.votes() {
+		s.Histogram[bucketLabel(i)] = *votes
+	}
+	return nil
+}
+
+func (s *MovieRatingStats) votes() [ratingBuckets]*int64 {
+	return [ratingBuckets]*int64{&s.Votes05, &s.Votes10, &s.Votes15, &s.Votes20, &s.Votes25,
+		&s.Votes30, &s.Votes35, &s.Votes40, &s.Votes45, &s.Votes50}
+}
+
+// bucket returns histogram index of rating value
+func bucket(rating float64) int {
+	i := int(rating*2+0.5) - 1
+	if i < 0 {
+		return 0
+	}
+	if i >= ratingBuckets {
+		return ratingBuckets - 1
+	}
+	return i
+}
+
+// bucketLabel returns rating value of histogram index, e.g. "3.5"
+func bucketLabel(i int) string {
+	return strconv.FormatFloat(float64(i+1)/2, 'f', 1, 64)
+}
+
+// bucketColumn returns vote column of histogram index, e.g. votes_35
+func bucketColumn(i int) string {
+	return fmt.Sprintf("votes_%02d", (i+1)*5)
+}
+
+// sameID reports whether optional references point to the same object
+func sameID(a, b *uint) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// adjustRatingStats adds delta votes of rating to movie aggregate in transaction tx,
+// delta is 1 for added ratings and -1 for removed ones
+func adjustRatingStats(tx *gorm.DB, movieID *uint, rating float32, delta int) error {
+	if movieID == nil {
+		return nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MovieRatingStats{MovieID: *movieID}).Error; err != nil {
+		return err
+	}
+
+	column := bucketColumn(bucket(float64(rating)))
+	err := tx.Model(&MovieRatingStats{}).Where("movie_id = ?", *movieID).Updates(map[string]interface{}{
+		"vote_count": gorm.Expr("vote_count + ?", delta),
+		"rating_sum": gorm.Expr("rating_sum + ?", float64(delta)*float64(rating)),
+		column:       gorm.Expr(column+" + ?", delta),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// average is computed in separate statement, MySQL would see updated sum and count in the same one
+	return tx.Model(&MovieRatingStats{}).Where("movie_id = ?", *movieID).
+		Update("avg_rating", gorm.Expr("CASE WHEN vote_count > 0 THEN rating_sum / vote_count ELSE 0 END")).Error
+}
+
+// RebuildRatingStats recomputes aggregates of all movies from ratings and returns number of rated movies
+func RebuildRatingStats(ctx context.Context) (int, error) {
+	db, err := get_db(ctx)
+	if err != nil {
+		return 0, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	count, err := rebuildRatingStats(db)
+	if err != nil {
+		return 0, &InternalError{Message: fmt.Sprintf("can't rebuild rating stats: %s", err.Error())}
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{"movies": count}).Info("Rebuilt movie rating stats")
+
+	return count, nil
+}
+
+func rebuildRatingStats(db *gorm.DB) (int, error) {
+	var rows []struct {
+		MovieID uint
+		Rating  float64
+		Count   int64
+	}
+	err := db.Model(&Rating{}).Select("movie_id, rating, COUNT(*) AS count").Where("movie_id IS NOT NULL").
+		Group("movie_id, rating").Order("movie_id").Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	stats := []*MovieRatingStats{}
+	for _, r := range rows {
+		if len(stats) == 0 || stats[len(stats)-1].MovieID != r.MovieID {
+			stats = append(stats, &MovieRatingStats{MovieID: r.MovieID})
+		}
+		s := stats[len(stats)-1]
+		*s.votes()[bucket(r.Rating)] += r.Count
+		s.VoteCount += r.Count
+		s.RatingSum += r.Rating * float64(r.Count)
+	}
+	for _, s := range stats {
+		s.AvgRating = s.RatingSum / float64(s.VoteCount)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&MovieRatingStats{}).Error; err != nil {
+			return err
+		}
+		if len(stats) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(stats, purgeBatchSize).Error
+	})
+	return len(stats), err
+}
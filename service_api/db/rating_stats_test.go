@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		rating float64
+		want   int
+		label  string
+		column string
+	}{
+		{0.5, 0, "0.5", "votes_05"},
+		{1, 1, "1.0", "votes_10"},
+		{3.5, 6, "3.5", "votes_35"},
+		{5, 9, "5.0", "votes_50"},
+		{0, 0, "0.5", "votes_05"},
+		{7, 9, "5.0", "votes_50"},
+	}
+
+	for _, tt := range tests {
+		i := bucket(tt.rating)
+		if i != tt.want || bucketLabel(i) != tt.label || bucketColumn(i) != tt.column {
+			t.Errorf("bucket(%v) = %d, %s, %s, want %d, %s, %s", tt.rating, i, bucketLabel(i), bucketColumn(i), tt.want, tt.label, tt.column)
+		}
+	}
+}
+
+// loadRatingStats returns stored stats by movie id
+func loadRatingStats(t *testing.T, db *gorm.DB) map[uint]MovieRatingStats {
+	var stats []MovieRatingStats
+	if err := db.Find(&stats).Error; err != nil {
+		t.Fatal(err)
+	}
+	byMovie := map[uint]MovieRatingStats{}
+	for _, s := range stats {
+		// movies without ratings left are kept with zero counts by incremental updates
+		if s.VoteCount > 0 {
+			byMovie[s.MovieID] = s
+		}
+	}
+	return byMovie
+}
+
+func TestRatingStatsMatchRebuild(t *testing.T) {
+	ctx := context.Background()
+	id := func(v uint) *uint { return &v }
+
+	tests := []struct {
+		name  string
+		steps func(t *testing.T)
+		// want are vote count and average of movie 1
+		wantCount int64
+		wantAvg   float64
+	}{
+		{"added ratings", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, addRating(ctx, &Rating{UserID: id(2), MovieID: id(1), Rating: 2.5}))
+		}, 2, 3.25},
+		{"batch", func(t *testing.T) {
+			must(t, addRatings(ctx, []Rating{{UserID: id(1), MovieID: id(1), Rating: 5}, {UserID: id(2), MovieID: id(1), Rating: 5}, {UserID: id(1), MovieID: id(2), Rating: 1}}))
+		}, 2, 5},
+		{"changed value", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, updateRating(ctx, 1, &Rating{UserID: id(1), MovieID: id(1), Rating: 1.5}, 1))
+		}, 1, 1.5},
+		{"moved to other movie", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, addRating(ctx, &Rating{UserID: id(2), MovieID: id(1), Rating: 3}))
+			must(t, updateRating(ctx, 1, &Rating{UserID: id(1), MovieID: id(2), Rating: 4}, 1))
+		}, 1, 3},
+		{"deleted rating", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, addRating(ctx, &Rating{UserID: id(2), MovieID: id(1), Rating: 3}))
+			must(t, deleteRating(ctx, 2, 1))
+		}, 1, 4},
+		{"deleted last rating", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, deleteRating(ctx, 1, 1))
+		}, 0, 0},
+		{"restored rating", func(t *testing.T) {
+			must(t, addRating(ctx, &Rating{UserID: id(1), MovieID: id(1), Rating: 4}))
+			must(t, addRating(ctx, &Rating{UserID: id(2), MovieID: id(1), Rating: 3}))
+			must(t, deleteRating(ctx, 2, 1))
+			var r Rating
+			must(t, findDeleted(ctx, 2, &r))
+			must(t, restoreObject(ctx, "ratings", r.ID, &r))
+		}, 2, 3.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, &Movie{}, &MovieRatingStats{}, &User{}, &Rating{}, &AuditEntry{})
+			for i := 1; i <= 2; i++ {
+				must(t, db.Create(&User{Username: "u", Name: "N", Sex: "X", Address: "A st", EMail: "a@b.cd"}).Error)
+				must(t, db.Create(&Movie{Name: "M", Imdb_Id: uint(i), Tmdb_Id: uint(i), Genres: StringArray{"Drama"}}).Error)
+			}
+
+			tt.steps(t)
+
+			incremental := loadRatingStats(t, db)
+			s := incremental[1]
+			if s.VoteCount != tt.wantCount || s.AvgRating != tt.wantAvg {
+				t.Errorf("movie 1 stats = %d votes, %v average, want %d, %v", s.VoteCount, s.AvgRating, tt.wantCount, tt.wantAvg)
+			}
+
+			if _, err := RebuildRatingStats(ctx); err != nil {
+				t.Fatal(err)
+			}
+			rebuilt := loadRatingStats(t, db)
+
+			if len(incremental) != len(rebuilt) {
+				t.Fatalf("incremental stats of %d movies, rebuilt of %d", len(incremental), len(rebuilt))
+			}
+			for movieID, want := range rebuilt {
+				got := incremental[movieID]
+				if got.VoteCount != want.VoteCount || got.RatingSum != want.RatingSum || got.AvgRating != want.AvgRating || !sameVotes(&got, &want) {
+					t.Errorf("incremental stats of movie %d = %+v, rebuilt %+v", movieID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func sameVotes(a, b *MovieRatingStats) bool {
+	av, bv := a.votes(), b.votes()
+	for i := range av {
+		if *av[i] != *bv[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
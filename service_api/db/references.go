@@ -0,0 +1,245 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"example/service/api/auth"
+	"example/service/api/config"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// reference is a foreign key value of an object, field is reported when the referenced row is missing
+type reference struct {
+	field string
+	table string
+	id    *uint
+}
+
+// referrer is implemented by models holding foreign keys
+type referrer interface {
+	references(prefix string) []reference
+}
+
+func (r *Rating) references(prefix string) []reference {
+	return []reference{
+		{field: prefix + "user_id", table: "users", id: r.UserID},
+		{field: prefix + "movie_id", table: "movies", id: r.MovieID},
+	}
+}
+
+func (t *Tag) references(prefix string) []reference {
+	return []reference{
+		{field: prefix + "user_id", table: "users", id: t.UserID},
+		{field: prefix + "movie_id", table: "movies", id: t.MovieID},
+	}
+}
+
+func (i *MovieImdbInfo) references(prefix string) []reference {
+	return []reference{{field: prefix + "movie_id", table: "movies", id: i.MovieId}}
+}
+
+func (i *MovieTmdbInfo) references(prefix string) []reference {
+	return []reference{{field: prefix + "movie_id", table: "movies", id: i.MovieId}}
+}
+
+// checkReferences returns ReferenceError when rows referenced by objects don't exist or are soft deleted.
+// objects is a referrer or a slice of models implementing it, fields of slice items are prefixed with index.
+func checkReferences(tx *gorm.DB, objects interface{}) error {
+	var refs []reference
+	if r, ok := objects.(referrer); ok {
+		refs = r.references("")
+	} else {
+		value := reflect.Indirect(reflect.ValueOf(objects))
+		for i := 0; i < value.Len(); i++ {
+			refs = append(refs, value.Index(i).Addr().Interface().(referrer).references(fmt.Sprintf("[%d].", i))...)
+		}
+	}
+
+	ids := map[string][]uint{}
+	for _, r := range refs {
+		if r.id != nil {
+			ids[r.table] = append(ids[r.table], *r.id)
+		}
+	}
+
+	existing := map[string]map[uint]bool{}
+	for table, tableIDs := range ids {
+		var found []uint
+		if err := tx.Table(table).Where("id IN ? AND deleted_at IS NULL", tableIDs).Pluck("id", &found).Error; err != nil {
+			return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		}
+		existing[table] = map[uint]bool{}
+		for _, id := range found {
+			existing[table][id] = true
+		}
+	}
+
+	missing := map[string]uint{}
+	for _, r := range refs {
+		if r.id != nil && !existing[r.table][*r.id] {
+			missing[r.field] = *r.id
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(missing))
+	for f := range missing {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return &ReferenceError{
+		Message: fmt.Sprintf("referenced objects don't exist: %s", strings.Join(fields, ", ")),
+		Missing: missing,
+	}
+}
+
+// childRelation is a foreign key column of entity referencing a deleted parent
+type childRelation struct {
+	entity string
+	model  interface{}
+	column string
+}
+
+var userChildren = []childRelation{
+	{entity: auth.ResourceRatings, model: &Rating{}, column: "user_id"},
+	{entity: auth.ResourceTags, model: &Tag{}, column: "user_id"},
+}
+
+var movieChildren = []childRelation{
+	{entity: auth.ResourceRatings, model: &Rating{}, column: "movie_id"},
+	{entity: auth.ResourceTags, model: &Tag{}, column: "movie_id"},
+	{entity: auth.ResourceMovieImdbInfo, model: &MovieImdbInfo{}, column: "movie_id"},
+	{entity: auth.ResourceMovieTmdbInfo, model: &MovieTmdbInfo{}, column: "movie_id"},
+}
+
+// applyOnDelete prepares deletion of parent object in transaction tx: children are deleted with cascade
+// policy, detached with set-null policy and with restrict policy existing children refuse the deletion.
+// Changed children are recorded in audit log.
+func applyOnDelete(tx *gorm.DB, policy string, parent string, parentID uint, children []childRelation) error {
+	for _, c := range children {
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(c.model).Elem()))
+		if err := tx.Where(c.column+" = ?", parentID).Find(rows.Interface()).Error; err != nil {
+			return err
+		}
+		items := rows.Elem()
+		if items.Len() == 0 {
+			continue
+		}
+
+		switch policy {
+		case config.OnDeleteRestrict:
+			return &ConstraintError{Message: fmt.Sprintf("%s <%d> is referenced by %d %s", parent, parentID, items.Len(), c.entity)}
+		case config.OnDeleteCascade:
+			if err := tx.Where(c.column+" = ?", parentID).Delete(c.model).Error; err != nil {
+				return err
+			}
+		case config.OnDeleteSetNull:
+			if err := tx.Model(c.model).Where(c.column+" = ?", parentID).Updates(map[string]interface{}{c.column: nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown on delete policy <%s>", policy)
+		}
+
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			id := uint(item.FieldByName("ID").Uint())
+			var err error
+			if policy == config.OnDeleteCascade {
+				err = recordDeletion(tx, c.entity, id, item.Addr().Interface())
+				if err == nil {
+					err = audit(tx, AuditDelete, c.entity, id, item.Interface(), nil)
+				}
+			} else {
+				err = recordDetached(tx, c, id, item.Addr().Interface())
+				if err == nil {
+					err = audit(tx, AuditUpdate, c.entity, id, map[string]interface{}{c.column: parentID}, map[string]interface{}{c.column: nil})
+				}
+			}
+			if err != nil {
+				return err
+			}
+			// ratings leaving a movie are removed from its rating stats
+			if r, ok := item.Addr().Interface().(*Rating); ok && (policy == config.OnDeleteCascade || c.column == "movie_id") {
+				if err := adjustRatingStats(tx, r.MovieID, r.Rating, -1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// recordDetached records revisions of child object before and after its reference was set to null
+func recordDetached(tx *gorm.DB, c childRelation, id uint, old interface{}) error {
+	if _, ok := revisionTables[c.entity]; !ok {
+		return nil
+	}
+	if err := recordRevision(tx, RevisionBaseline, c.entity, id, old); err != nil {
+		return err
+	}
+	detached := reflect.New(reflect.TypeOf(c.model).Elem()).Interface()
+	if err := tx.Where("id = ?", id).Limit(1).Find(detached).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, AuditUpdate, c.entity, id, detached)
+}
+
+// repairReferences resolves references to missing users and movies left by data written before
+// foreign keys were enforced, so constraints can be created. Dangling rows are handled by on delete
+// policy, with restrict policy their presence fails the migration.
+func repairReferences(db *gorm.DB, cfg config.OnDeleteConfig) error {
+	parents := []struct {
+		table    string
+		policy   string
+		children []childRelation
+	}{
+		{table: "users", policy: cfg.User, children: userChildren},
+		{table: "movies", policy: cfg.Movie, children: movieChildren},
+	}
+
+	for _, p := range parents {
+		if !db.Migrator().HasTable(p.table) {
+			continue
+		}
+		for _, c := range p.children {
+			if !db.Migrator().HasTable(c.model) {
+				continue
+			}
+			dangling := db.Model(c.model).Where(c.column+" IS NOT NULL AND "+c.column+" NOT IN (?)", db.Table(p.table).Select("id"))
+
+			var result *gorm.DB
+			switch p.policy {
+			case config.OnDeleteRestrict:
+				var count int64
+				if err := dangling.Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return fmt.Errorf("%d %s reference missing %s, delete them or choose cascade or set-null on delete policy", count, c.entity, p.table)
+				}
+				continue
+			case config.OnDeleteCascade:
+				result = dangling.Delete(c.model)
+			case config.OnDeleteSetNull:
+				result = dangling.Update(c.column, nil)
+			default:
+				return fmt.Errorf("unknown on delete policy <%s>", p.policy)
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				log.WithFields(log.Fields{"entity": c.entity, "column": c.column, "policy": p.policy, "rows": result.RowsAffected}).Warn("Repaired references to missing objects")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"example/service/api/auth"
+	"example/service/api/config"
+	"example/service/api/logging"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// RevisionBaseline is the state of object changed for the first time since history is kept
+	RevisionBaseline = "baseline"
+	RevisionRevert   = "revert"
+)
+
+// Snapshot is json representation of an object, it's stored as JSON
+type Snapshot map[string]interface{}
+
+func (Snapshot) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case config.DbDriverPostgres:
+		return "jsonb"
+	case config.DbDriverMysql:
+		return "JSON"
+	default:
+		return "text"
+	}
+}
+
+func (s Snapshot) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (s *Snapshot) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("can't scan %T into Snapshot", src)
+	}
+}
+
+// Revision is full snapshot of an object after a change, Revision is the object version
+type Revision struct {
+	ID         uint      `gorm:"primaryKey" json:"-" xml:"-"`
+	ObjectID   uint      `gorm:"index" json:"object_id" xml:"object_id"`
+	Revision   uint      `json:"revision" xml:"revision"`
+	Action     string    `gorm:"size:16" json:"action" xml:"action"`
+	Actor      string    `gorm:"size:255" json:"actor" xml:"actor"`
+	RequestID  string    `gorm:"size:64" json:"request_id" xml:"request_id"`
+	RecordedAt time.Time `json:"recorded_at" xml:"recorded_at"`
+	Snapshot   Snapshot  `json:"snapshot" xml:"-"`
+}
+
+// MovieRevision, MovieImdbInfoRevision and MovieTmdbInfoRevision define revision tables of entities
+type MovieRevision struct{ Revision }
+type MovieImdbInfoRevision struct{ Revision }
+type MovieTmdbInfoRevision struct{ Revision }
+
+// revisionTables maps entities keeping history to their revision tables
+var revisionTables = map[string]string{
+	auth.ResourceMovies:        "movie_revisions",
+	auth.ResourceMovieImdbInfo: "movie_imdb_info_revisions",
+	auth.ResourceMovieTmdbInfo: "movie_tmdb_info_revisions",
+}
+
+// objectVersion returns Version field of model pointer
+func objectVersion(object interface{}) uint {
+	return uint(reflect.Indirect(reflect.ValueOf(object)).FieldByName("Version").Uint())
+}
+
+// recordRevision stores snapshot of object in transaction tx, entities without history are ignored.
+// Existing revision is kept, so baselines can be recorded unconditionally.
+func recordRevision(tx *gorm.DB, action, entity string, id uint, object interface{}) error {
+	table, ok := revisionTables[entity]
+	if !ok {
+		return nil
+	}
+
+	version := objectVersion(object)
+	var count int64
+	if err := tx.Table(table).Where("object_id = ? AND revision = ?", id, version).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	snapshot, err := toFields(object)
+	if err != nil {
+		return fmt.Errorf("can't take snapshot: %w", err)
+	}
+
+	rev := Revision{
+		ObjectID:   id,
+		Revision:   version,
+		Action:     action,
+		Actor:      auditSystemActor,
+		RequestID:  logging.RequestID(tx.Statement.Context),
+		RecordedAt: time.Now().UTC(),
+		Snapshot:   snapshot,
+	}
+	if p := auth.FromContext(tx.Statement.Context); p != nil {
+		rev.Actor = p.ID
+	}
+	return tx.Table(table).Create(&rev).Error
+}
+
+// recordDeletion records revisions of object soft deleted in transaction tx, old is its state before deletion.
+// Deletion increments version, so the deleted state gets revision of its own.
+func recordDeletion(tx *gorm.DB, entity string, id uint, old interface{}) error {
+	if _, ok := revisionTables[entity]; !ok {
+		return nil
+	}
+	if err := recordRevision(tx, RevisionBaseline, entity, id, old); err != nil {
+		return err
+	}
+	deleted := reflect.New(reflect.Indirect(reflect.ValueOf(old)).Type()).Interface()
+	if err := tx.Unscoped().Model(deleted).Where("id = ?", id).UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("id = ?", id).Limit(1).Find(deleted).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, AuditDelete, entity, id, deleted)
+}
+
+func listRevisions(ctx context.Context, entity string, id int, limit, offset int) ([]Revision, error) {
+	revisions := []Revision{}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return revisions, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Table(revisionTables[entity]).Where("object_id = ?", id).Order("revision desc").Limit(limit).Offset(offset).Find(&revisions)
+
+	if result.Error != nil {
+		return revisions, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	return revisions, nil
+}
+
+func queryRevision(ctx context.Context, entity string, id int, rev int) (Revision, error) {
+	var revision Revision
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return revision, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Table(revisionTables[entity]).Where("object_id = ? AND revision = ?", id, rev).Limit(1).Find(&revision)
+
+	if result.Error != nil {
+		return revision, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return revision, &QueryConditionError{Message: fmt.Sprintf("can't find revision <%d> of object <%d>", rev, id)}
+	}
+
+	return revision, nil
+}
+
+// findObject loads object of model by id
+func findObject(ctx context.Context, id int, model interface{}) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Where("id = ?", id).Limit(1).Find(model)
+
+	if result.Error != nil {
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
+	}
+
+	return nil
+}
+
+const (
+	defaultRevisionLimit = 50
+	maxRevisionLimit     = 500
+)
+
+func revisionError(g *gin.Context, err error) {
+	switch {
+	case errors.As(err, &intErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	case errors.As(err, &qCondErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+	case errors.As(err, &refErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
+	case errors.As(err, &precondErr):
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+	default:
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	}
+}
+
+// listRevisionsHandler lists revisions of entity object, newest first
+func listRevisionsHandler(g *gin.Context, entity string) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := parseLimit(g, "limit", defaultRevisionLimit, maxRevisionLimit)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	offset := 0
+	if v := g.Query("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid offset <%s>", v)})
+			return
+		}
+	}
+
+	revisions, err := listRevisions(g.Request.Context(), entity, id, limit, offset)
+	if err != nil {
+		revisionError(g, err)
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// diffRevisionsHandler compares revisions given by from and to query parameters
+func diffRevisionsHandler(g *gin.Context, entity string) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var revs [2]Revision
+	for i, name := range []string{"from", "to"} {
+		rev, err := strconv.Atoi(g.Query(name))
+		if err != nil {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s <%s>, revision number expected", name, g.Query(name))})
+			return
+		}
+		revs[i], err = queryRevision(g.Request.Context(), entity, id, rev)
+		if err != nil {
+			revisionError(g, err)
+			return
+		}
+	}
+
+	diff, err := diffFields(entity, revs[0].Snapshot, revs[1].Snapshot)
+	if err != nil {
+		revisionError(g, err)
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"from": revs[0].Revision, "to": revs[1].Revision, "diff": diff})
+}
+
+// revertHandler replaces object with validated snapshot of revision given by rev parameter. current receives the object,
+// target the snapshot and update saves target with the expected object version.
+func revertHandler(g *gin.Context, entity string, current, target interface{}, update func(ctx context.Context, id int, version uint) error) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rev, err := strconv.Atoi(g.Param("rev"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := findObject(g.Request.Context(), id, current); err != nil {
+		revisionError(g, err)
+		return
+	}
+
+	version := objectVersion(current)
+	if !checkIfMatch(g, version) {
+		return
+	}
+
+	revision, err := queryRevision(g.Request.Context(), entity, id, rev)
+	if err != nil {
+		revisionError(g, err)
+		return
+	}
+
+	data, err := json.Marshal(revision.Snapshot)
+	if err == nil {
+		err = json.Unmarshal(data, target)
+	}
+	if err != nil {
+		revisionError(g, &InternalError{Message: fmt.Sprintf("can't read snapshot: %s", err.Error())})
+		return
+	}
+
+	// snapshot may hold values which don't pass current validation rules
+	if err := validateBody(target); err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusUnprocessableEntity, bindErrorBody(err))
+		return
+	}
+
+	if err := update(g.Request.Context(), id, version); err != nil {
+		revisionError(g, err)
+		return
+	}
+
+	g.Header("ETag", etag(objectVersion(target)))
+	g.JSON(http.StatusOK, gin.H{"status": fmt.Sprintf("object is reverted to revision %d", rev), "object": target})
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"example/service/api/auth"
+	"example/service/api/config"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// purgeBatchSize limits number of objects purged in one transaction
+const purgeBatchSize = 500
+
+// findDeleted loads soft deleted object of model by id
+func findDeleted(ctx context.Context, id int, model interface{}) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	result := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Limit(1).Find(model)
+
+	if result.Error != nil {
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
+	}
+
+	if result.RowsAffected == 0 {
+		return &QueryConditionError{Message: fmt.Sprintf("can't find deleted object by this id <%d>", id)}
+	}
+
+	return nil
+}
+
+// restoreObject undeletes object loaded by findDeleted, objects referencing deleted users or movies
+// can't be restored before them
+func restoreObject(ctx context.Context, entity string, id uint, object interface{}) error {
+	db, err := get_db(ctx)
+	if err != nil {
+		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if r, ok := object.(referrer); ok {
+			if err := checkReferences(tx, r); err != nil {
+				return err
+			}
+		}
+		if err := recordRevision(tx, RevisionBaseline, entity, id, object); err != nil {
+			return err
+		}
+		deletedAt := reflect.Indirect(reflect.ValueOf(object)).FieldByName("DeletedAt")
+		old := map[string]interface{}{"deleted_at": deletedAt.Interface()}
+		if err := tx.Unscoped().Model(object).Where("id = ?", id).Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		deletedAt.Set(reflect.ValueOf(gorm.DeletedAt{}))
+		version := reflect.Indirect(reflect.ValueOf(object)).FieldByName("Version")
+		version.SetUint(version.Uint() + 1)
+		if err := recordRevision(tx, AuditRestore, entity, id, object); err != nil {
+			return err
+		}
+		if r, ok := object.(*Rating); ok {
+			if err := adjustRatingStats(tx, r.MovieID, r.Rating, 1); err != nil {
+				return err
+			}
+		}
+		return audit(tx, AuditRestore, entity, id, old, map[string]interface{}{"deleted_at": nil})
+	})
+	if err != nil {
+		return transactionError(err, "restore")
+	}
+
+	log.WithContext(ctx).Info("Restore " + entity + " with id: <" + strconv.Itoa(int(id)) + ">")
+
+	return nil
+}
+
+// restoreHandler restores soft deleted object of entity, owner returns user owning loaded object
+// when principals may restore only their own objects
+func restoreHandler(g *gin.Context, entity string, object interface{}, owner func() uint) {
+	id, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = findDeleted(g.Request.Context(), id, object)
+	if err == nil && owner != nil && !requireOwner(g, owner()) {
+		return
+	}
+	if err == nil {
+		err = restoreObject(g.Request.Context(), entity, uint(id), object)
+	}
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"status": "object is restored", "object": object})
+}
+
+// purgeOrder lists entities referencing others first, so parents are purged after their children
+var purgeOrder = []struct {
+	entity   string
+	model    interface{}
+	children []childRelation
+}{
+	{entity: auth.ResourceRatings, model: &Rating{}},
+	{entity: auth.ResourceTags, model: &Tag{}},
+	{entity: auth.ResourceMovieImdbInfo, model: &MovieImdbInfo{}},
+	{entity: auth.ResourceMovieTmdbInfo, model: &MovieTmdbInfo{}},
+	{entity: auth.ResourceUsers, model: &User{}, children: userChildren},
+	{entity: auth.ResourceMovies, model: &Movie{}, children: movieChildren},
+}
+
+// PurgeDeleted permanently deletes objects soft deleted more than retention ago and returns their
+// number by entity. Users and movies still referenced by other objects are kept until those are purged.
+func PurgeDeleted(ctx context.Context, retention time.Duration) (map[string]int64, error) {
+	purged := map[string]int64{}
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return purged, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	cutoff := time.Now().UTC().Add(-retention)
+	for _, p := range purgeOrder {
+		for {
+			query := db.Unscoped().Model(p.model).Where("deleted_at < ?", cutoff)
+			for _, c := range p.children {
+				query = query.Where("id NOT IN (?)", db.Unscoped().Model(c.model).Select(c.column).Where(c.column+" IS NOT NULL"))
+			}
+
+			var ids []uint
+			if err := query.Order("id").Limit(purgeBatchSize).Pluck("id", &ids).Error; err != nil {
+				return purged, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Where("id IN ?", ids).Delete(p.model).Error; err != nil {
+					return err
+				}
+				if table, ok := revisionTables[p.entity]; ok {
+					if err := tx.Table(table).Where("object_id IN ?", ids).Delete(&Revision{}).Error; err != nil {
+						return err
+					}
+				}
+				return auditPurges(tx, p.entity, ids)
+			})
+			if err != nil {
+				return purged, &InternalError{Message: fmt.Sprintf("can't perform purge operation: %s", err.Error())}
+			}
+			purged[p.entity] += int64(len(ids))
+
+			if len(ids) < purgeBatchSize {
+				break
+			}
+		}
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{"purged": purged, "retention": retention.String()}).Info("Purged deleted objects")
+
+	return purged, nil
+}
+
+// auditPurges records permanent deletion of objects, their data is in audit entries of the soft deletion
+func auditPurges(tx *gorm.DB, entity string, ids []uint) error {
+	entries := make([]AuditEntry, 0, len(ids))
+	for _, id := range ids {
+		entry, err := newAuditEntry(tx.Statement.Context, AuditPurge, entity, id, nil, nil)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return tx.Create(&entries).Error
+}
+
+// RunPurgeSchedule purges deleted objects every interval until ctx is done
+func RunPurgeSchedule(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PurgeDeleted(ctx, retention); err != nil {
+				log.WithContext(ctx).Error(err)
+			}
+		}
+	}
+}
+
+// Purge deleted objects
+// @Summary Purge deleted objects
+// @Description Permanently deletes objects soft deleted before the retention period
+// @Tags db
+// @Accept json
+// @Produce json
+// @Param retention query string false "retention period, e.g. 720h, PURGE_RETENTION by default"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /db/purge [post]
+func PurgeHandler(g *gin.Context) {
+	retention := config.GetPurgeConfig().Retention
+	if v := g.Query("retention"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid retention <%s>", v)})
+			return
+		}
+		retention = d
+	}
+
+	purged, err := PurgeDeleted(g.Request.Context(), retention)
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	g.JSON(http.StatusOK, gin.H{"status": "deleted objects are purged", "purged": purged})
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"example/service/api/config"
+
+	pq "github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// StringArray is a list of strings stored as a native array column on
+// Postgres and as a JSON encoded column on MySQL and SQLite.
+// Set `gorm:"size:N"` on a field to get varchar(N)[] instead of text[] on Postgres.
+type StringArray []string
+
+func (StringArray) GormDataType() string {
+	return "string_array"
+}
+
+func (StringArray) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case config.DbDriverPostgres:
+		if field.Size > 0 {
+			return fmt.Sprintf("varchar(%d)[]", field.Size)
+		}
+		return "text[]"
+	case config.DbDriverMysql:
+		return "JSON"
+	default:
+		return "text"
+	}
+}
+
+func (a StringArray) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	if db.Dialector.Name() == config.DbDriverPostgres {
+		return clause.Expr{SQL: "?", Vars: []interface{}{pq.StringArray(a)}}
+	}
+	data, err := a.json()
+	if err != nil {
+		db.AddError(err)
+	}
+	return clause.Expr{SQL: "?", Vars: []interface{}{data}}
+}
+
+// Value is used outside of GORM statements, e.g. in raw queries,
+// and keeps the Postgres array literal format
+func (a StringArray) Value() (driver.Value, error) {
+	return pq.StringArray(a).Value()
+}
+
+// Scan accepts both Postgres array literals and JSON arrays,
+// so data can be read regardless of the backend that wrote it
+func (a *StringArray) Scan(src interface{}) error {
+	var data string
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		data = string(v)
+	case string:
+		data = v
+	default:
+		return fmt.Errorf("can't scan %T into StringArray", src)
+	}
+
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(data), &values); err != nil {
+			return fmt.Errorf("can't scan json into StringArray: %w", err)
+		}
+		*a = values
+		return nil
+	}
+
+	var values pq.StringArray
+	if err := values.Scan([]byte(data)); err != nil {
+		return err
+	}
+	*a = StringArray(values)
+	return nil
+}
+
+func (a StringArray) json() (string, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(a))
+	return string(data), err
+}
+
+// arrayContains returns condition matching rows whose StringArray column holds value
+func arrayContains(db *gorm.DB, column string, value string) clause.Expr {
+	switch db.Dialector.Name() {
+	case config.DbDriverPostgres:
+		return gorm.Expr("? = ANY("+column+")", value)
+	case config.DbDriverMysql:
+		return gorm.Expr("JSON_CONTAINS("+column+", JSON_QUOTE(?))", value)
+	default:
+		return gorm.Expr("EXISTS (SELECT 1 FROM json_each("+column+") WHERE json_each.value = ?)", value)
+	}
+}
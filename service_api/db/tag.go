@@ -1,27 +1,52 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type Tag struct {
 	ID      uint   `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	UserID  uint   `form:"user_id" json:"user_id" xml:"user_id" binding:"required"`
-	User    User   `gorm:"foreignKey:UserID" json:"-" swaggerignore:"true" binding:"-"`
-	MovieID uint   `form:"movie_id" json:"movie_id" xml:"movie_id" binding:"required"`
-	Movie   Movie  `gorm:"foreignKey:MovieID" json:"-" swaggerignore:"true" binding:"-"`
-	TagText string `form:"tag_text" json:"tag_text" xml:"tag_text"  binding:"required"`
+	UserID  *uint  `form:"user_id" json:"user_id" xml:"user_id" binding:"required"`
+	User    User   `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
+	MovieID *uint  `form:"movie_id" json:"movie_id" xml:"movie_id" binding:"required"`
+	Movie   Movie  `gorm:"foreignKey:MovieID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-" swaggerignore:"true" binding:"-"`
+	TagText string `form:"tag_text" json:"tag_text" xml:"tag_text"  binding:"required,max=256"`
+	// TaggedAt is when the user tagged the movie, creation time by default
+	TaggedAt  time.Time      `gorm:"index" form:"tagged_at" json:"tagged_at" xml:"tagged_at" binding:"omitempty,past_time"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt time.Time      `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listTags() ([]Tag, error) {
-	db, err := get_db()
+// BeforeCreate starts version history and defaults TaggedAt to creation time
+func (t *Tag) BeforeCreate(tx *gorm.DB) error {
+	t.Version = 1
+	if t.TaggedAt.IsZero() {
+		t.TaggedAt = tx.Statement.DB.NowFunc()
+	}
+	return nil
+}
+
+func (t *Tag) normalize() {
+	t.TagText = strings.TrimSpace(t.TagText)
+}
+
+func listTags(ctx context.Context, f ListFilter) ([]Tag, error) {
+	db, err := get_db(ctx)
 
 	var tags []Tag
 
@@ -29,42 +54,57 @@ func listTags() ([]Tag, error) {
 		return tags, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&tags)
+	result := f.apply(db).Find(&tags)
 
 	if result.Error != nil {
-		return tags, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return tags, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return tags, nil
 }
 
-func addTag(t *Tag) error {
-	db, err := get_db()
+func addTag(ctx context.Context, t *Tag) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(t)
-
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, t); err != nil {
+			return err
+		}
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceTags, t.ID, nil, t)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert Tag with id: <" + strconv.Itoa(int(t.ID)) + ">")
+	log.WithContext(ctx).Info("Insert Tag with id: <" + strconv.Itoa(int(t.ID)) + ">")
 	return nil
 }
 
-func addTags(tags []Tag) error {
-	db, err := get_db()
+func addTags(ctx context.Context, tags []Tag) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(tags)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, tags); err != nil {
+			return err
+		}
+		if err := tx.Create(tags).Error; err != nil {
+			return err
+		}
+		return auditCreates(tx, auth.ResourceTags, len(tags), func(i int) (uint, interface{}) { return tags[i].ID, tags[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -73,20 +113,20 @@ func addTags(tags []Tag) error {
 		t = t + strconv.Itoa(int(m.ID)) + ";"
 	}
 
-	log.Info("Insert Tags with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert Tags with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryTag(id int) (Tag, error) {
-	db, err := get_db()
+func queryTag(ctx context.Context, id int, includeDeleted bool, preloads ...string) (Tag, error) {
+	db, err := get_db(ctx)
 	var tag Tag
 
 	if err != nil {
 		return tag, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&tag)
+	result := preload(withDeleted(db, includeDeleted), preloads).Where("id = ?", id).Limit(1).Find(&tag)
 
 	if result.Error != nil {
 		return tag, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -99,14 +139,14 @@ func queryTag(id int) (Tag, error) {
 	return tag, nil
 }
 
-func updateTag(id int, tag *Tag) error {
-	db, err := get_db()
+func updateTag(ctx context.Context, id int, tag *Tag, version uint) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 	var data Tag
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -115,31 +155,74 @@ func updateTag(id int, tag *Tag) error {
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
-	result = db.Model(&data).Select("*").Omit("id").Updates(tag)
+	if tag.TaggedAt.IsZero() {
+		tag.TaggedAt = data.TaggedAt
+	}
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, tag); err != nil {
+			return err
+		}
+		tag.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at").Updates(tag)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		tag.ID = data.ID
+		tag.CreatedAt = data.CreatedAt
+		tag.UpdatedAt = data.UpdatedAt
+		return audit(tx, AuditUpdate, auth.ResourceTags, data.ID, old, tag)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteTag(id int) error {
-	db, err := get_db()
+func deleteTag(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&Tag{}, id)
+	var data Tag
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		return audit(tx, AuditDelete, auth.ResourceTags, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
@@ -149,18 +232,45 @@ func deleteTag(id int) error {
 // @Tags tags
 // @Accept json
 // @Produce json
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param tagged_from query string false "RFC 3339 time, inclusive lower bound of tagged_at"
+// @Param tagged_to query string false "RFC 3339 time, exclusive upper bound of tagged_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.tmdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags [get]
 func ListTagsHandler(g *gin.Context) {
-	tags, err := listTags()
+	filter, err := parseListFilter(g, "created_at", "updated_at", "tagged_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceTags, &Tag{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	tags, err := listTags(g.Request.Context(), filter)
 
 	if err != nil {
-		log.Error(err)
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
-	g.JSON(http.StatusOK, gin.H{"tags": tags})
+	writeExpanded(g, "tags", expansion, tags)
 }
 
 // Add tag
@@ -172,32 +282,44 @@ func ListTagsHandler(g *gin.Context) {
 // @Param tag body db.Tag true "tag info"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags [post]
 func AddTagHandler(g *gin.Context) {
 	var json Tag
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+	if !requireOwner(g, ownerID(json.UserID)) {
 		return
 	}
-	err := addTag(&json)
+
+	err := addTag(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 	g.JSON(http.StatusOK, gin.H{"status": "tag is created", "tag": json})
 }
 
@@ -210,35 +332,51 @@ func AddTagHandler(g *gin.Context) {
 // @Param tags body []db.Tag true "tags info"
 // @Success 200
 // Failure 400
+// @Failure 413
+// @Failure 422
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags/insert_batch [post]
 func AddTagsHandler(g *gin.Context) {
 	var json []Tag
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	if !checkBatchSize(g, len(json)) {
 		return
 	}
 
-	err := addTags(json)
+	for _, r := range json {
+		if !requireOwner(g, ownerID(r.UserID)) {
+			return
+		}
+	}
+
+	err := addTags(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "tags": json})
@@ -251,9 +389,18 @@ func AddTagsHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "tag id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.tmdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
+// @Failure 403
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags/{id} [get]
 func QueryTagHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -262,23 +409,38 @@ func QueryTagHandler(g *gin.Context) {
 		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	tag, err := queryTag(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceTags, &Tag{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	tag, err := queryTag(g.Request.Context(), id, includeDeleted, expansion.preloads...)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
-	g.JSON(http.StatusOK, gin.H{"tag": tag})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, tag.Version) {
+		return
+	}
+
+	writeExpanded(g, "tag", expansion, tag)
 }
 
 // Update tag
@@ -289,10 +451,19 @@ func QueryTagHandler(g *gin.Context) {
 // @Produce json
 // @Param user body db.Tag true "tag info"
 // @Param id path integer true "tag id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 422
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags/{id} [patch]
+// @Router /tags/{id} [put]
 func UpdateTagHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -301,28 +472,59 @@ func UpdateTagHandler(g *gin.Context) {
 	}
 	var json Tag
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err = updateTag(id, &json)
+	existing, err := queryTag(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !requireOwner(g, ownerID(existing.UserID), ownerID(json.UserID)) {
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = updateTag(g.Request.Context(), id, &json, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &refErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusUnprocessableEntity, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "sucess"})
 }
 
@@ -333,9 +535,16 @@ func UpdateTagHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "tag id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 403
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /tags/{id} [delete]
 func DeleteTagHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -344,18 +553,45 @@ func DeleteTagHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteTag(id)
+	existing, err := queryTag(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !requireOwner(g, ownerID(existing.UserID)) {
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteTag(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -363,3 +599,152 @@ func DeleteTagHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "tag is deleted"})
 }
+
+// Restore tag
+// @Summary Restore tag
+// @Description Restores soft deleted tag by id, the referenced objects must not be deleted
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path integer true "tag id"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 422
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /tags/{id}/restore [post]
+func RestoreTagHandler(g *gin.Context) {
+	var tag Tag
+	restoreHandler(g, auth.ResourceTags, &tag, func() uint { return ownerID(tag.UserID) })
+}
+
+// Get tags of user
+// @Summary Get tags of user
+// @Description Get list of tags of user specified by id
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path integer true "user id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param tagged_from query string false "RFC 3339 time, inclusive lower bound of tagged_at"
+// @Param tagged_to query string false "RFC 3339 time, exclusive upper bound of tagged_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.tmdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/tags [get]
+func ListUserTagsHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at", "tagged_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceTags, &Tag{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &User{}, "user_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	tags, err := listTags(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "tags", expansion, tags)
+}
+
+// Get tags of movie
+// @Summary Get tags of movie
+// @Description Get list of tags of movie specified by id
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path integer true "movie id"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param tagged_from query string false "RFC 3339 time, inclusive lower bound of tagged_at"
+// @Param tagged_to query string false "RFC 3339 time, exclusive upper bound of tagged_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param include query string false "comma separated related objects to embed, e.g. user,movie,movie.tmdb_info, users other than own lack personal data"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /movies/{id}/tags [get]
+func ListMovieTagsHandler(g *gin.Context) {
+	filter, err := parseListFilter(g, "created_at", "updated_at", "tagged_at")
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceTags, &Tag{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+
+	if err := filterByParent(g.Request.Context(), g.Param("id"), &Movie{}, "movie_id", &filter); err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	tags, err := listTags(g.Request.Context(), filter)
+
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
+		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	writeExpanded(g, "tags", expansion, tags)
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	statementTimeoutCancelKey  = "statement_timeout:cancel"
+	statementTimeoutContextKey = "statement_timeout:context"
+)
+
+// statementTimeoutBefore limits statement with timeout. The deadline is derived
+// from the statement context, so request cancellation still applies.
+func statementTimeoutBefore(tx *gorm.DB, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(tx.Statement.Context, timeout)
+	tx.InstanceSet(statementTimeoutContextKey, tx.Statement.Context)
+	tx.Statement.Context = ctx
+	tx.InstanceSet(statementTimeoutCancelKey, cancel)
+}
+
+// statementTimeoutAfter releases the timeout and restores the statement context,
+// so the finished statement can be chained, e.g. in FindInBatches callbacks
+func statementTimeoutAfter(tx *gorm.DB) {
+	if cancel, ok := tx.InstanceGet(statementTimeoutCancelKey); ok {
+		cancel.(context.CancelFunc)()
+	}
+	if ctx, ok := tx.InstanceGet(statementTimeoutContextKey); ok {
+		tx.Statement.Context = ctx.(context.Context)
+	}
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"example/service/api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "tracing:span"
+
+// tracingBefore starts span of statement, child of span in statement context
+func tracingBefore(tx *gorm.DB, operation string) {
+	ctx, span := tracing.Tracer().Start(tx.Statement.Context, "gorm."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(tx.Dialector.Name()),
+			semconv.DBOperationKey.String(operation),
+		))
+	tx.Statement.Context = ctx
+	tx.InstanceSet(tracingSpanKey, span)
+}
+
+func tracingAfter(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBSQLTableKey.String(tx.Statement.Table),
+		semconv.DBStatementKey.String(tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
@@ -1,69 +1,121 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"example/service/api/auth"
+	"example/service/api/config"
 	notifier "example/service/api/notifier"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type User struct {
 	ID       uint   `gorm:"primaryKey" json:"id" xml:"id" swaggerignore:"true"`
-	Username string `form:"username" json:"username" xml:"username"  binding:"required"`
-	Name     string `form:"name" json:"name" xml:"name"  binding:"required"`
-	Sex      string `form:"sex" json:"sex" xml:"sex"  binding:"required"`
-	Address  string `form:"address" json:"address" xml:"address"  binding:"required"`
-	EMail    string `form:"email" json:"email" xml:"email"  binding:"required"`
+	Username string `form:"username" json:"username" xml:"username"  binding:"required,max=64"`
+	Name     string `form:"name" json:"name" xml:"name"  binding:"required,max=128"`
+	Sex      string `form:"sex" json:"sex" xml:"sex"  binding:"required,oneof=M F X" enums:"M,F,X"`
+	Address  string `gorm:"serializer:encrypted" form:"address" json:"address" xml:"address"  binding:"required,max=512"`
+	EMail    string `gorm:"serializer:encrypted" form:"email" json:"email" xml:"email"  binding:"required,max=254,email"`
+	// EMailIndex is blind index of EMail, encrypted emails are looked up by it
+	EMailIndex string         `gorm:"size:64;index" json:"-" xml:"-" swaggerignore:"true" binding:"-"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at" xml:"created_at" swaggerignore:"true" binding:"-"`
+	UpdatedAt  time.Time      `gorm:"index" json:"updated_at" xml:"updated_at" swaggerignore:"true" binding:"-"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at" xml:"deleted_at" swaggerignore:"true" binding:"-"`
+	// Version is incremented on every change, it is the ETag of the object
+	Version uint `gorm:"not null;default:1" json:"version" xml:"version" swaggerignore:"true" binding:"-"`
 }
 
-func listUsers() ([]User, error) {
+// BeforeCreate starts version history, versions sent by clients are ignored
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	u.Version = 1
+	return nil
+}
+
+func (u *User) normalize() {
+	u.Username = strings.TrimSpace(u.Username)
+	u.Name = strings.TrimSpace(u.Name)
+	u.Sex = strings.ToUpper(strings.TrimSpace(u.Sex))
+	u.Address = strings.TrimSpace(u.Address)
+	u.EMail = normalizeEmail(u.EMail)
+}
+
+func listUsers(ctx context.Context, email string, f ListFilter) ([]User, error) {
 	var users []User
-	db, err := get_db()
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return users, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Find(&users)
+	query := f.apply(db)
+	if email != "" {
+		if index := emailIndex(email); index != "" {
+			query = query.Where("e_mail_index = ?", index)
+		} else {
+			query = query.Where("e_mail = ?", email)
+		}
+	}
+
+	result := query.Find(&users)
 
 	if result.Error != nil {
-		return users, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+		return users, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	return users, nil
 }
 
-func addUser(u *User) error {
-	db, err := get_db()
+func addUser(ctx context.Context, u *User) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(u)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	u.EMailIndex = emailIndex(u.EMail)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		return audit(tx, AuditCreate, auth.ResourceUsers, u.ID, nil, u)
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
-	log.Info("Insert User with id: <" + strconv.Itoa(int(u.ID)) + ">")
+	log.WithContext(ctx).Info("Insert User with id: <" + strconv.Itoa(int(u.ID)) + ">")
 
 	return nil
 }
 
-func addUsers(users []User) error {
-	db, err := get_db()
+func addUsers(ctx context.Context, users []User) error {
+	db, err := get_db(ctx)
 
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Create(users)
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform insert operation: %s", result.Error.Error())}
+	for i := range users {
+		users[i].EMailIndex = emailIndex(users[i].EMail)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(users).Error; err != nil {
+			return err
+		}
+		return auditCreates(tx, auth.ResourceUsers, len(users), func(i int) (uint, interface{}) { return users[i].ID, users[i] })
+	})
+	if err != nil {
+		return transactionError(err, "insert")
 	}
 
 	t := ""
@@ -72,13 +124,13 @@ func addUsers(users []User) error {
 		t = t + strconv.Itoa(int(u.ID)) + ";"
 	}
 
-	log.Info("Insert Users with ids: <" + t + ">")
+	log.WithContext(ctx).Info("Insert Users with ids: <" + t + ">")
 
 	return nil
 }
 
-func queryUser(id int) (User, error) {
-	db, err := get_db()
+func queryUser(ctx context.Context, id int, includeDeleted bool) (User, error) {
+	db, err := get_db(ctx)
 
 	var user User
 
@@ -86,7 +138,7 @@ func queryUser(id int) (User, error) {
 		return user, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Where("id = ?", id).First(&user)
+	result := withDeleted(db, includeDeleted).Where("id = ?", id).Limit(1).Find(&user)
 
 	if result.Error != nil {
 		return user, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -99,14 +151,14 @@ func queryUser(id int) (User, error) {
 	return user, nil
 }
 
-func updateUser(id int, user *User) error {
-	db, err := get_db()
+func updateUser(ctx context.Context, id int, user *User, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
 	var data User
-	result := db.Where("id = ?", id).First(&data)
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
 		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
@@ -116,51 +168,126 @@ func updateUser(id int, user *User) error {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
-	result = db.Model(&data).Select("*").Omit("id").Updates(user)
+	user.EMailIndex = emailIndex(user.EMail)
 
-	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform update operation: %s", result.Error.Error())}
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	old := data
+	err = db.Transaction(func(tx *gorm.DB) error {
+		user.Version = data.Version + 1
+		result := tx.Model(&data).Where("version = ?", version).Select("*").Omit("id", "created_at", "deleted_at").Updates(user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		user.ID = data.ID
+		user.CreatedAt = data.CreatedAt
+		user.UpdatedAt = data.UpdatedAt
+		return audit(tx, AuditUpdate, auth.ResourceUsers, data.ID, old, user)
+	})
+	if err != nil {
+		return transactionError(err, "update")
 	}
 
 	return nil
 }
 
-func deleteUser(id int) error {
-	db, err := get_db()
+func deleteUser(ctx context.Context, id int, version uint) error {
+	db, err := get_db(ctx)
 	if err != nil {
 		return &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
 	}
 
-	result := db.Delete(&User{}, id)
+	var data User
+	result := db.Where("id = ?", id).Limit(1).Find(&data)
 
 	if result.Error != nil {
-		return &InternalError{Message: fmt.Sprintf("can't perform delete operation: %s", result.Error.Error())}
+		return &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", result.Error.Error())}
 	}
 
 	if result.RowsAffected == 0 {
 		return &QueryConditionError{Message: fmt.Sprintf("can't find object by this id <%d>", id)}
 	}
 
+	if data.Version != version {
+		return &PreconditionError{Message: fmt.Sprintf("object version is %d, expected %d", data.Version, version)}
+	}
+
+	onDelete, err := config.GetOnDeleteConfig()
+	if err != nil {
+		return &InternalError{Message: err.Error()}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := applyOnDelete(tx, onDelete.User, auth.ResourceUsers, data.ID, userChildren); err != nil {
+			return err
+		}
+		result := tx.Where("version = ?", version).Delete(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &PreconditionError{Message: "object was changed concurrently"}
+		}
+		return audit(tx, AuditDelete, auth.ResourceUsers, data.ID, data, nil)
+	})
+	if err != nil {
+		return transactionError(err, "delete")
+	}
+
 	return nil
 }
 
 // Get users
 // @Summary Get Users
-// @Description Get list of all users
+// @Description Get list of all users, end users see only themselves
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param email query string false "find users by email"
+// @Param created_from query string false "RFC 3339 time, inclusive lower bound of created_at"
+// @Param created_to query string false "RFC 3339 time, exclusive upper bound of created_at"
+// @Param updated_from query string false "RFC 3339 time, inclusive lower bound of updated_at"
+// @Param updated_to query string false "RFC 3339 time, exclusive upper bound of updated_at"
+// @Param include_deleted query boolean false "show soft deleted objects"
+// @Param limit query integer false "page size, all objects by default"
+// @Param offset query integer false "number of skipped objects, pages are ordered by id"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
 // @Success 200
+// @Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users [get]
 func ListUsersHandler(g *gin.Context) {
-	users, err := listUsers()
+	filter, err := parseListFilter(g, "created_at", "updated_at")
 	if err != nil {
-		log.Error(err)
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceUsers, &User{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	filter.Preloads = expansion.preloads
+	// users holding only their own data list just themselves
+	if userID, ok := auth.OwnedBy(g); ok {
+		filter.Scopes = append(filter.Scopes, func(db *gorm.DB) *gorm.DB { return db.Where("id = ?", userID) })
+	}
+
+	users, err := listUsers(g.Request.Context(), g.Query("email"), filter)
+	if err != nil {
+		log.WithContext(g.Request.Context()).Error(err)
 		g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
-	g.JSON(http.StatusOK, gin.H{"users": users})
+	writeExpanded(g, "users", expansion, users)
 }
 
 // Add user
@@ -173,34 +300,35 @@ func ListUsersHandler(g *gin.Context) {
 // @Success 200
 // Failure 400
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users [post]
 func AddUserHandler(g *gin.Context) {
 	var json User
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
 		return
 	}
 
-	err := addUser(&json)
+	err := addUser(g.Request.Context(), &json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	notifier.ObjectCreationNotificationChannel <- json
+	notifier.Notify(g.Request.Context(), json)
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "user": json})
 }
@@ -214,35 +342,41 @@ func AddUserHandler(g *gin.Context) {
 // @Param users body []db.User true "users info"
 // @Success 200
 // Failure 400
+// @Failure 413
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users/insert_batch [post]
 func AddUsersHandler(g *gin.Context) {
 	var json []User
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		body, _ := g.GetRawData()
-		log.WithFields(log.Fields{"request_body": body}).Error(err)
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	if !checkBatchSize(g, len(json)) {
 		return
 	}
 
-	err := addUsers(json)
+	err := addUsers(g.Request.Context(), json)
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 	for _, u := range json {
-		notifier.ObjectCreationNotificationChannel <- u
+		notifier.Notify(g.Request.Context(), u)
 	}
 
 	g.JSON(http.StatusOK, gin.H{"status": "success", "users": json})
@@ -250,14 +384,22 @@ func AddUsersHandler(g *gin.Context) {
 
 // Query user
 // @Summary Query user
-// @Description Shows user by id
+// @Description Shows user by id, end users see only themselves
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path integer true "user id"
-// @Success 200
+// @Param include_deleted query boolean false "show soft deleted object"
+// @Param fields query string false "comma separated fields to return, fields of included objects are prefixed, e.g. movie.name"
+// @Param If-None-Match header string false "ETag of cached object"
+// @Success 200 {string} string "object, ETag header holds its version"
+// @Success 304
 // @Failure 400
+// @Failure 403
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users/{id} [get]
 func QueryUserHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -265,24 +407,42 @@ func QueryUserHandler(g *gin.Context) {
 		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	user, err := queryUser(id)
+	includeDeleted, err := parseIncludeDeleted(g)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	expansion, err := parseExpansion(g, auth.ResourceUsers, &User{})
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if !requireOwner(g, uint(id)) {
+		return
+	}
+	user, err := queryUser(g.Request.Context(), id, includeDeleted)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
-	g.JSON(http.StatusOK, gin.H{"user": user})
+	// included objects change independently of the object version
+	if len(expansion.includes) == 0 && writeETag(g, user.Version) {
+		return
+	}
+
+	writeExpanded(g, "user", expansion, user)
 }
 
 // Update user
@@ -293,10 +453,17 @@ func QueryUserHandler(g *gin.Context) {
 // @Produce json
 // @Param user body db.User true "user info"
 // @Param id path integer true "user id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users/{id} [patch]
+// @Router /users/{id} [put]
 func UpdateUserHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
 	if err != nil {
@@ -306,28 +473,52 @@ func UpdateUserHandler(g *gin.Context) {
 
 	var json User
 
-	if err := g.ShouldBindJSON(&json); err != nil {
-		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(g, &json); err != nil {
+		g.JSON(bindErrorStatus(err), bindErrorBody(err))
+		return
+	}
+
+	existing, err := queryUser(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
 		return
 	}
 
-	err = updateUser(id, &json)
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = updateUser(g.Request.Context(), id, &json, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
 	}
 
+	g.Header("ETag", etag(json.Version))
 	g.JSON(http.StatusOK, gin.H{"status": "success"})
 }
 
@@ -338,9 +529,16 @@ func UpdateUserHandler(g *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path integer true "user id"
+// @Param If-Match header string false "ETag of the object, required when REQUIRE_IF_MATCH is set"
 // @Success 200
 // @Failure 400
+// @Failure 409
+// @Failure 412
+// @Failure 428
 // @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /users/{id} [delete]
 func DeleteUserHandler(g *gin.Context) {
 	id, err := strconv.Atoi(g.Param("id"))
@@ -349,18 +547,44 @@ func DeleteUserHandler(g *gin.Context) {
 		return
 	}
 
-	err = deleteUser(id)
+	existing, err := queryUser(g.Request.Context(), id, false)
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	if !checkIfMatch(g, existing.Version) {
+		return
+	}
+
+	err = deleteUser(g.Request.Context(), id, existing.Version)
 
 	if err != nil {
 		switch {
 		case errors.As(err, &intErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		case errors.As(err, &qCondErr):
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		case errors.As(err, &precondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusPreconditionFailed, gin.H{"error": err})
+		case errors.As(err, &constraintErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusConflict, gin.H{"error": err})
 		default:
-			log.Error(err)
+			log.WithContext(g.Request.Context()).Error(err)
 			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		}
 		return
@@ -368,3 +592,21 @@ func DeleteUserHandler(g *gin.Context) {
 
 	g.JSON(http.StatusOK, gin.H{"status": "user is deleted"})
 }
+
+// Restore user
+// @Summary Restore user
+// @Description Restores soft deleted user by id
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "user id"
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/restore [post]
+func RestoreUserHandler(g *gin.Context) {
+	restoreHandler(g, auth.ResourceUsers, &User{}, nil)
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultFavoriteRating is the lowest rating of movies counted in favourite genres
+const defaultFavoriteRating = 4.0
+
+// GenreCount is number of highly rated movies of a genre
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int64  `json:"count"`
+}
+
+// TagUsage summarizes tags given by a user
+type TagUsage struct {
+	Count    int64      `json:"count"`
+	Distinct int64      `json:"distinct"`
+	TopTags  []TagCount `json:"top_tags"`
+}
+
+// GlobalComparison compares a user to the average of all users who rated a movie
+type GlobalComparison struct {
+	GlobalMean     float64 `json:"global_mean"`
+	MeanDiff       float64 `json:"mean_diff"`
+	RatingsPerUser float64 `json:"ratings_per_user"`
+	// RatingsRatio is number of user ratings relative to RatingsPerUser
+	RatingsRatio float64 `json:"ratings_ratio"`
+}
+
+// UserStats is activity profile of a user, activity times are null for users without ratings and tags
+type UserStats struct {
+	User           User             `json:"user"`
+	Ratings        RatingStats      `json:"ratings"`
+	FavoriteGenres []GenreCount     `json:"favorite_genres"`
+	Tags           TagUsage         `json:"tags"`
+	FirstActivity  *time.Time       `json:"first_activity"`
+	LastActivity   *time.Time       `json:"last_activity"`
+	Comparison     GlobalComparison `json:"comparison"`
+}
+
+func queryUserStats(ctx context.Context, id int, favoriteRating float64, topGenres, topTags int) (UserStats, error) {
+	var stats UserStats
+
+	user, err := queryUser(ctx, id, false)
+	if err != nil {
+		return stats, err
+	}
+	stats.User = user
+
+	db, err := get_db(ctx)
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't open database connection: %s", err.Error())}
+	}
+
+	var ratings []struct {
+		Rating float64
+		Count  int64
+	}
+	err = db.Model(&Rating{}).Select("rating, COUNT(*) AS count").Where("user_id = ?", id).Group("rating").Scan(&ratings).Error
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	stats.Ratings.Histogram = map[string]int64{}
+	for i := 0; i < ratingBuckets; i++ {
+		stats.Ratings.Histogram[bucketLabel(i)] = 0
+	}
+	var sum float64
+	for _, r := range ratings {
+		stats.Ratings.Histogram[bucketLabel(bucket(r.Rating))] += r.Count
+		stats.Ratings.Count += r.Count
+		sum += r.Rating * float64(r.Count)
+	}
+	if stats.Ratings.Count > 0 {
+		stats.Ratings.Mean = sum / float64(stats.Ratings.Count)
+	}
+
+	// genres are arrays, so they're counted here rather than grouped by the database
+	var genres []StringArray
+	err = db.Model(&Rating{}).Joins("JOIN movies ON movies.id = ratings.movie_id AND movies.deleted_at IS NULL").
+		Where("ratings.user_id = ? AND ratings.rating >= ?", id, favoriteRating).Pluck("movies.genres", &genres).Error
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	counts := map[string]int64{}
+	for _, movieGenres := range genres {
+		for _, genre := range movieGenres {
+			counts[genre]++
+		}
+	}
+	stats.FavoriteGenres = make([]GenreCount, 0, len(counts))
+	for genre, count := range counts {
+		stats.FavoriteGenres = append(stats.FavoriteGenres, GenreCount{Genre: genre, Count: count})
+	}
+	sort.Slice(stats.FavoriteGenres, func(i, j int) bool {
+		a, b := stats.FavoriteGenres[i], stats.FavoriteGenres[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Genre < b.Genre
+	})
+	if len(stats.FavoriteGenres) > topGenres {
+		stats.FavoriteGenres = stats.FavoriteGenres[:topGenres]
+	}
+
+	var tags struct {
+		Count int64
+		Texts int64
+	}
+	err = db.Model(&Tag{}).Select("COUNT(*) AS count, COUNT(DISTINCT tag_text) AS texts").Where("user_id = ?", id).Scan(&tags).Error
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	stats.Tags.Count, stats.Tags.Distinct = tags.Count, tags.Texts
+	stats.Tags.TopTags = []TagCount{}
+	err = db.Model(&Tag{}).Select("tag_text, COUNT(*) AS count").Where("user_id = ?", id).
+		Group("tag_text").Order("count desc, tag_text").Limit(topTags).Scan(&stats.Tags.TopTags).Error
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+
+	// times are plucked from ordered rows, MIN and MAX lose column types on SQLite
+	for _, q := range []struct {
+		model  interface{}
+		column string
+	}{{&Rating{}, "rated_at"}, {&Tag{}, "tagged_at"}} {
+		for _, order := range []string{"asc", "desc"} {
+			var times []time.Time
+			err = db.Model(q.model).Where("user_id = ?", id).Order(q.column+" "+order).Limit(1).Pluck(q.column, &times).Error
+			if err != nil {
+				return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+			}
+			if len(times) == 0 {
+				continue
+			}
+			t := times[0]
+			if order == "asc" && (stats.FirstActivity == nil || t.Before(*stats.FirstActivity)) {
+				stats.FirstActivity = &t
+			}
+			if order == "desc" && (stats.LastActivity == nil || t.After(*stats.LastActivity)) {
+				stats.LastActivity = &t
+			}
+		}
+	}
+
+	var global struct {
+		Mean  float64
+		Count int64
+		Users int64
+	}
+	err = db.Model(&Rating{}).Select("COALESCE(AVG(rating), 0) AS mean, COUNT(*) AS count, COUNT(DISTINCT user_id) AS users").Scan(&global).Error
+	if err != nil {
+		return stats, &InternalError{Message: fmt.Sprintf("can't perform query operation: %s", err.Error())}
+	}
+	stats.Comparison.GlobalMean = global.Mean
+	if stats.Ratings.Count > 0 {
+		stats.Comparison.MeanDiff = stats.Ratings.Mean - global.Mean
+	}
+	if global.Users > 0 {
+		stats.Comparison.RatingsPerUser = float64(global.Count) / float64(global.Users)
+		stats.Comparison.RatingsRatio = float64(stats.Ratings.Count) / stats.Comparison.RatingsPerUser
+	}
+
+	return stats, nil
+}
+
+// Get user activity statistics
+// @Summary Get user activity statistics
+// @Description Shows rating statistics of user, favourite genres of highly rated movies, tag usage, first and last activity and comparison to all users
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path integer true "user id"
+// @Param min_rating query number false "lowest rating of movies counted in favourite genres, 4 by default"
+// @Param top_genres query integer false "number of favourite genres, 10 by default"
+// @Param top_tags query integer false "number of top tags, 10 by default"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Security BasicAuth
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /users/{id}/stats [get]
+func QueryUserStatsHandler(g *gin.Context) {
+	id, err := strconv.Atoi(g.Param("id"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// stats embed the user and profile their activity, so they're as private as the user
+	if !requireOwner(g, uint(id)) {
+		return
+	}
+
+	favoriteRating := defaultFavoriteRating
+	if v := g.Query("min_rating"); v != "" {
+		favoriteRating, err = strconv.ParseFloat(v, 64)
+		if err != nil || favoriteRating < 0.5 || favoriteRating > 5 {
+			g.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid min_rating <%s>, expected 0.5..5", v)})
+			return
+		}
+	}
+	topGenres, err := parseLimit(g, "top_genres", defaultDetailsLimit, maxDetailsLimit)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	topTags, err := parseLimit(g, "top_tags", defaultDetailsLimit, maxDetailsLimit)
+	if err != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	stats, err := queryUserStats(g.Request.Context(), id, favoriteRating, topGenres, topTags)
+
+	if err != nil {
+		switch {
+		case errors.As(err, &intErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		case errors.As(err, &qCondErr):
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusBadRequest, gin.H{"error": err})
+		default:
+			log.WithContext(g.Request.Context()).Error(err)
+			g.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		}
+		return
+	}
+
+	g.JSON(http.StatusOK, stats)
+}
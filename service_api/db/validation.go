@@ -0,0 +1,216 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"example/service/api/config"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// minYear is the year of the earliest surviving motion pictures
+const minYear = 1870
+
+// maxYearAhead allows announced movies
+const maxYearAhead = 10
+
+// clockSkew tolerates clients whose clocks run ahead
+const clockSkew = 5 * time.Minute
+
+var genreVocabulary = map[string]string{}
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("rating_step", func(fl validator.FieldLevel) bool {
+		r := fl.Field().Float() * 2
+		return math.Abs(r-math.Round(r)) < 1e-6
+	})
+	v.RegisterValidation("plausible_year", func(fl validator.FieldLevel) bool {
+		y := int(fl.Field().Uint())
+		return y >= minYear && y <= time.Now().Year()+maxYearAhead
+	})
+	v.RegisterValidation("past_time", func(fl validator.FieldLevel) bool {
+		t, ok := fl.Field().Interface().(time.Time)
+		return ok && !t.After(time.Now().Add(clockSkew))
+	})
+	v.RegisterValidation("http_url", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	})
+	v.RegisterValidation("genre", func(fl validator.FieldLevel) bool {
+		_, ok := genreVocabulary[strings.ToLower(fl.Field().String())]
+		return ok
+	})
+}
+
+// InitValidation loads genre vocabulary
+func InitValidation() {
+	genreVocabulary = map[string]string{}
+	for _, g := range config.GetGenreVocabulary() {
+		g = strings.TrimSpace(g)
+		if g != "" {
+			genreVocabulary[strings.ToLower(g)] = g
+		}
+	}
+}
+
+// normalizer is implemented by models which clean up bound values before validation
+type normalizer interface {
+	normalize()
+}
+
+func trimAll(values StringArray) StringArray {
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return values
+}
+
+// canonicalGenres trims genres and fixes their case to the one of vocabulary
+func canonicalGenres(genres StringArray) StringArray {
+	for i, g := range trimAll(genres) {
+		if c, ok := genreVocabulary[strings.ToLower(g)]; ok {
+			genres[i] = c
+		}
+	}
+	return genres
+}
+
+// ValidationError lists problems of request body by field,
+// fields of batch items are prefixed with item index, e.g. "[2].email"
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, 0, len(names))
+	for _, name := range names {
+		problems = append(problems, name+": "+e.Fields[name])
+	}
+	return "validation failed: " + strings.Join(problems, "; ")
+}
+
+func fieldProblem(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		if isString {
+			return "must be at least " + fe.Param() + " characters long"
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if isString {
+			return "must be at most " + fe.Param() + " characters long"
+		}
+		if fe.Kind() == reflect.Slice {
+			return "must have at most " + fe.Param() + " items"
+		}
+		return "must be at most " + fe.Param()
+	case "rating_step":
+		return "must be a multiple of 0.5"
+	case "plausible_year":
+		return fmt.Sprintf("must be between %d and %d", minYear, time.Now().Year()+maxYearAhead)
+	case "past_time":
+		return "must not be in the future"
+	case "http_url":
+		return "must be an absolute http or https URL"
+	case "genre":
+		return fmt.Sprintf("unknown genre <%v>", fe.Value())
+	default:
+		return "failed on " + fe.Tag() + " rule"
+	}
+}
+
+// fieldErrors converts validator errors to field problems, the struct name is replaced with prefix
+func fieldErrors(err error, prefix string, fields map[string]string) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	for _, fe := range errs {
+		name := fe.Namespace()
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		fields[prefix+name] = fieldProblem(fe)
+	}
+	return nil
+}
+
+// validateBody normalizes and validates bound struct or slice of structs
+func validateBody(obj interface{}) error {
+	fields := map[string]string{}
+
+	value := reflect.Indirect(reflect.ValueOf(obj))
+	if value.Kind() == reflect.Slice {
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i).Addr().Interface()
+			if n, ok := item.(normalizer); ok {
+				n.normalize()
+			}
+			if err := fieldErrors(binding.Validator.ValidateStruct(item), fmt.Sprintf("[%d].", i), fields); err != nil {
+				return err
+			}
+		}
+	} else {
+		if n, ok := obj.(normalizer); ok {
+			n.normalize()
+		}
+		if err := fieldErrors(binding.Validator.ValidateStruct(obj), "", fields); err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// jsonBody decodes request body without validation, which runs after normalization
+type jsonBody struct{}
+
+func (jsonBody) Name() string {
+	return "json"
+}
+
+func (jsonBody) Bind(req *http.Request, obj interface{}) error {
+	return json.NewDecoder(req.Body).Decode(obj)
+}
+
+func (jsonBody) BindBody(body []byte, obj interface{}) error {
+	return json.Unmarshal(body, obj)
+}
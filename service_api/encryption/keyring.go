@@ -0,0 +1,173 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values, values without it are treated as plaintext written before encryption was enabled
+const prefix = "enc:v1:"
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// keyFile is the format of keys file:
+//
+//	{"active": "2022-07", "keys": {"2022-01": "<base64>", "2022-07": "<base64>"}, "blind_index_key": "<base64>"}
+//
+// Keys are 32 bytes long (AES-256). Values are encrypted with active key and decrypted with the key
+// they were encrypted with, so rotation is adding a new active key and re-encrypting stored data.
+type keyFile struct {
+	Active        string            `json:"active"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blind_index_key"`
+}
+
+// Keyring holds AES-GCM keys by id and HMAC key of blind indexes
+type Keyring struct {
+	active     string
+	aeads      map[string]cipher.AEAD
+	blindIndex []byte
+}
+
+func decodeKey(name, value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key <%s>: %w", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key <%s>: 32 bytes expected, got %d", name, len(key))
+	}
+	return key, nil
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read keys file: %w", err)
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid keys file: %w", err)
+	}
+	if _, ok := f.Keys[f.Active]; !ok {
+		return nil, fmt.Errorf("invalid keys file: active key <%s> is not defined", f.Active)
+	}
+
+	k := &Keyring{active: f.Active, aeads: map[string]cipher.AEAD{}}
+	for id, value := range f.Keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id <%s>: ':' is not allowed", id)
+		}
+		key, err := decodeKey(id, value)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+
+	k.blindIndex, err = decodeKey("blind_index_key", f.BlindIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Encrypt encrypts plaintext with active key, aad binds ciphertext to its location, e.g. table and column
+func (k *Keyring) Encrypt(plaintext, aad string) (string, error) {
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return prefix + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts value produced by Encrypt, values without encryption prefix are returned as is
+func (k *Keyring) Decrypt(value, aad string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	aead, ok := k.aeads[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w <%s>", ErrUnknownKey, parts[0])
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns deterministic keyed hash of value for equality lookups of encrypted data
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.blindIndex)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+var (
+	mu      sync.RWMutex
+	keyring *Keyring
+)
+
+// Init loads keyring used by Default, empty path leaves encryption disabled
+func Init(path string) error {
+	if path == "" {
+		return nil
+	}
+	k, err := LoadKeyring(path)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	keyring = k
+	mu.Unlock()
+	return nil
+}
+
+// Default returns keyring loaded by Init, nil when encryption is disabled
+func Default() *Keyring {
+	mu.RLock()
+	defer mu.RUnlock()
+	return keyring
+}
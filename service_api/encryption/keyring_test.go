@@ -0,0 +1,155 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func writeKeyFile(t *testing.T, f keyFile) string {
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadTestKeyring(t *testing.T, f keyFile) *Keyring {
+	k, err := LoadKeyring(writeKeyFile(t, f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestLoadKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    keyFile
+		wantErr bool
+	}{
+		{"valid", keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(1)}, BlindIndexKey: testKey(9)}, false},
+		{"undefined active key", keyFile{Active: "k2", Keys: map[string]string{"k1": testKey(1)}, BlindIndexKey: testKey(9)}, true},
+		{"short key", keyFile{Active: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}, BlindIndexKey: testKey(9)}, true},
+		{"key id with colon", keyFile{Active: "k:1", Keys: map[string]string{"k:1": testKey(1)}, BlindIndexKey: testKey(9)}, true},
+		{"missing blind index key", keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(1)}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyring(writeKeyFile(t, tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadKeyring() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringDecrypt(t *testing.T) {
+	old := loadTestKeyring(t, keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(1)}, BlindIndexKey: testKey(9)})
+	rotated := loadTestKeyring(t, keyFile{Active: "k2", Keys: map[string]string{"k1": testKey(1), "k2": testKey(2)}, BlindIndexKey: testKey(9)})
+	other := loadTestKeyring(t, keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(3)}, BlindIndexKey: testKey(9)})
+
+	encrypt := func(k *Keyring, plaintext, aad string) string {
+		value, err := k.Encrypt(plaintext, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	tamper := func(value string) string {
+		sealed, _ := base64.StdEncoding.DecodeString(value[strings.LastIndex(value, ":")+1:])
+		sealed[len(sealed)-1] ^= 1
+		return value[:strings.LastIndex(value, ":")+1] + base64.StdEncoding.EncodeToString(sealed)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		value   string
+		aad     string
+		want    string
+		wantErr bool
+	}{
+		{"round trip", old, encrypt(old, "a@b.cd", "users.e_mail"), "users.e_mail", "a@b.cd", false},
+		{"empty value", old, encrypt(old, "", "users.e_mail"), "users.e_mail", "", false},
+		{"old key after rotation", rotated, encrypt(old, "a@b.cd", "users.e_mail"), "users.e_mail", "a@b.cd", false},
+		{"active key after rotation", rotated, encrypt(rotated, "a@b.cd", "users.e_mail"), "users.e_mail", "a@b.cd", false},
+		{"key removed after rotation", old, encrypt(rotated, "a@b.cd", "users.e_mail"), "users.e_mail", "", true},
+		{"other key with same id", other, encrypt(old, "a@b.cd", "users.e_mail"), "users.e_mail", "", true},
+		{"value moved to other column", old, encrypt(old, "a@b.cd", "users.e_mail"), "users.address", "", true},
+		{"tampered value", old, tamper(encrypt(old, "a@b.cd", "users.e_mail")), "users.e_mail", "", true},
+		{"malformed value", old, prefix + "k1", "users.e_mail", "", true},
+		{"plaintext", old, "a@b.cd", "users.e_mail", "a@b.cd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Decrypt(tt.value, tt.aad)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := old.Decrypt(encrypt(rotated, "a@b.cd", ""), ""); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt() with removed key error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestKeyringEncrypt(t *testing.T) {
+	k := loadTestKeyring(t, keyFile{Active: "k2", Keys: map[string]string{"k1": testKey(1), "k2": testKey(2)}, BlindIndexKey: testKey(9)})
+
+	a, _ := k.Encrypt("a@b.cd", "users.e_mail")
+	b, _ := k.Encrypt("a@b.cd", "users.e_mail")
+	if !strings.HasPrefix(a, prefix+"k2:") || !IsEncrypted(a) {
+		t.Errorf("Encrypt() = %s, want value encrypted with active key k2", a)
+	}
+	if a == b {
+		t.Error("Encrypt() of the same value is deterministic")
+	}
+	if strings.Contains(a, "a@b.cd") {
+		t.Error("Encrypt() leaks plaintext")
+	}
+}
+
+func TestKeyringBlindIndex(t *testing.T) {
+	k := loadTestKeyring(t, keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(1)}, BlindIndexKey: testKey(9)})
+	rotated := loadTestKeyring(t, keyFile{Active: "k2", Keys: map[string]string{"k1": testKey(1), "k2": testKey(2)}, BlindIndexKey: testKey(9)})
+	other := loadTestKeyring(t, keyFile{Active: "k1", Keys: map[string]string{"k1": testKey(1)}, BlindIndexKey: testKey(8)})
+
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"same value", k.BlindIndex("a@b.cd"), k.BlindIndex("a@b.cd"), true},
+		{"other value", k.BlindIndex("a@b.cd"), k.BlindIndex("b@b.cd"), false},
+		{"rotated encryption key", k.BlindIndex("a@b.cd"), rotated.BlindIndex("a@b.cd"), true},
+		{"other blind index key", k.BlindIndex("a@b.cd"), other.BlindIndex("a@b.cd"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a == tt.b; got != tt.want {
+				t.Errorf("indexes %s and %s equal = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	db "example/service/api/db"
+	notifier "example/service/api/notifier"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const checkTimeout = 3 * time.Second
+
+type Check struct {
+	Name string
+	// Required checks make service not ready when they fail
+	Required bool
+	Run      func(ctx context.Context) (interface{}, error)
+}
+
+type CheckResult struct {
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	Required  bool        `json:"required"`
+	LatencyMs float64     `json:"latency_ms"`
+	Details   interface{} `json:"details,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+func runChecks(ctx context.Context, checks []Check) ([]CheckResult, bool) {
+	ready := true
+	results := make([]CheckResult, 0, len(checks))
+
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		start := time.Now()
+		details, err := c.Run(checkCtx)
+		latency := time.Since(start)
+		cancel()
+
+		r := CheckResult{
+			Name:      c.Name,
+			Status:    statusUp,
+			Required:  c.Required,
+			LatencyMs: float64(latency.Microseconds()) / 1000,
+			Details:   details,
+		}
+		if err != nil {
+			r.Status = statusDown
+			r.Error = publicMessage(c.Name, err)
+			log.WithContext(ctx).WithField("check", c.Name).Warn(err)
+			if c.Required {
+				ready = false
+			}
+		}
+		results = append(results, r)
+	}
+
+	return results, ready
+}
+
+// checkError is check failure which is safe to expose to unauthenticated clients
+type checkError struct {
+	message string
+}
+
+func (e *checkError) Error() string {
+	return e.message
+}
+
+func checkErrorf(format string, args ...interface{}) error {
+	return &checkError{message: fmt.Sprintf(format, args...)}
+}
+
+// publicMessage hides errors of dependencies, which may name hosts or hold connection strings, they're logged instead
+func publicMessage(name string, err error) string {
+	var ce *checkError
+	if errors.As(err, &ce) {
+		return ce.message
+	}
+	return name + " check failed"
+}
+
+func databaseCheck(ctx context.Context) (interface{}, error) {
+	return nil, db.Ping(ctx)
+}
+
+func migrationCheck(ctx context.Context) (interface{}, error) {
+	version, err := db.CurrentSchemaVersion(ctx)
+	details := gin.H{"current": version, "expected": db.SchemaVersion}
+	if err != nil {
+		return details, err
+	}
+	if version != db.SchemaVersion {
+		return details, checkErrorf("database schema version <%d> doesn't match expected <%d>", version, db.SchemaVersion)
+	}
+	return details, nil
+}
+
+// notifierCheck fails when notifier isn't running, its queue is full or its writes keep failing
+// and kafka broker is unreachable, reachable broker lets the next events retry writing
+func notifierCheck(ctx context.Context) (interface{}, error) {
+	status := notifier.GetStatus()
+	if !status.Healthy() {
+		if !status.Running {
+			return status, checkErrorf("notifier is not running")
+		}
+		return status, checkErrorf("notification queue is full, %d events are waiting", status.QueueDepth)
+	}
+	if status.WriteFailing(time.Now()) {
+		if err := notifier.Ping(ctx); err != nil {
+			log.WithContext(ctx).Warn(err)
+			return status, checkErrorf("last notification write failed at %s and kafka is unreachable", status.LastErrorAt.Format(time.RFC3339))
+		}
+	}
+	return status, nil
+}
+
+func kafkaCheck(ctx context.Context) (interface{}, error) {
+	return nil, notifier.Ping(ctx)
+}
+
+var readinessChecks = []Check{
+	{Name: "database", Required: true, Run: databaseCheck},
+	{Name: "migrations", Required: true, Run: migrationCheck},
+	{Name: "notifier", Required: true, Run: notifierCheck},
+}
+
+var statusChecks = append(readinessChecks, Check{Name: "kafka", Required: false, Run: kafkaCheck})
+
+// LivenessHandler reports that process is running
+func LivenessHandler(g *gin.Context) {
+	g.JSON(http.StatusOK, gin.H{"status": statusUp})
+}
+
+// ReadinessHandler reports whether service can serve requests: database is reachable, schema is migrated
+// and notifier is running with room in its queue and delivers notifications
+func ReadinessHandler(g *gin.Context) {
+	results, ready := runChecks(g.Request.Context(), readinessChecks)
+	respond(g, results, ready)
+}
+
+// StatusHandler reports status, latency and errors of every service dependency,
+// errors of dependencies are logged and answered without details
+func StatusHandler(g *gin.Context) {
+	results, ready := runChecks(g.Request.Context(), statusChecks)
+	respond(g, results, ready)
+}
+
+func respond(g *gin.Context, results []CheckResult, ready bool) {
+	code := http.StatusOK
+	status := statusUp
+	if !ready {
+		code = http.StatusServiceUnavailable
+		status = statusDown
+	}
+	g.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// AddRoutes registers probes on router root, outside of API base path
+func AddRoutes(r gin.IRouter) {
+	r.GET("/healthz", LivenessHandler)
+	r.GET("/readyz", ReadinessHandler)
+	r.GET("/status", StatusHandler)
+}
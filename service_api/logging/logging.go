@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"example/service/api/config"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatJson = "json"
+	FormatText = "text"
+)
+
+// Redacted replaces values of PII fields
+const Redacted = "[REDACTED]"
+
+type requestIdKey struct{}
+
+// WithRequestID returns context carrying request id,
+// it is attached to every log line written with this context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// contextHook adds request and trace ids from entry context, set with log.WithContext
+type contextHook struct{}
+
+func (contextHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (contextHook) Fire(e *log.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	if id := RequestID(e.Context); id != "" {
+		e.Data["request_id"] = id
+	}
+	if sc := trace.SpanContextFromContext(e.Context); sc.IsValid() {
+		e.Data["trace_id"] = sc.TraceID().String()
+		e.Data["span_id"] = sc.SpanID().String()
+	}
+	return nil
+}
+
+// redactHook masks values of PII fields passed with log.WithField
+type redactHook struct{}
+
+func (redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (redactHook) Fire(e *log.Entry) error {
+	for k := range e.Data {
+		if IsRedacted(k) {
+			e.Data[k] = Redacted
+		}
+	}
+	return nil
+}
+
+var redactedFields = map[string]bool{}
+
+// IsRedacted reports whether values of field are masked
+func IsRedacted(field string) bool {
+	return redactedFields[strings.ToLower(field)]
+}
+
+// Init configures level, format and hooks of the standard logger
+func Init() error {
+	cfg := config.GetLoggingConfig()
+
+	level, err := log.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	log.SetLevel(level)
+
+	switch cfg.Format {
+	case FormatJson:
+		log.SetFormatter(&log.JSONFormatter{})
+	case FormatText:
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	default:
+		return fmt.Errorf("unsupported log format <%s>", cfg.Format)
+	}
+
+	redactedFields = map[string]bool{}
+	for _, f := range cfg.RedactFields {
+		redactedFields[strings.ToLower(strings.TrimSpace(f))] = true
+	}
+
+	log.AddHook(contextHook{})
+	log.AddHook(redactHook{})
+	return nil
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if IsRedacted(k) {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// RedactJSON parses JSON document and masks values of PII fields at any depth
+func RedactJSON(data []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Sprintf("<%d bytes of invalid json>", len(data))
+	}
+	return redactValue(v)
+}
+
+// Redact returns JSON representation of v with PII fields masked
+func Redact(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%T can't be encoded: %s>", v, err.Error())
+	}
+	return RedactJSON(data)
+}
@@ -1,15 +1,32 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example/service/api/auth"
 	db "example/service/api/db"
 	"example/service/api/docs"
+	"example/service/api/encryption"
 
 	"example/service/api/config"
+	"example/service/api/health"
+	"example/service/api/logging"
+	"example/service/api/metrics"
+	"example/service/api/middleware"
 	notifier "example/service/api/notifier"
+	"example/service/api/ratelimit"
+	"example/service/api/tracing"
 
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
 	swaggerfiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // @title           Swagger Example API
@@ -29,18 +46,166 @@ import (
 
 // @securityDefinitions.basic  BasicAuth
 
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 JWT bearer token, "Bearer <token>"
+
+func newJwtAuthenticator(cfg config.JwtConfig) (*auth.JwtAuthenticator, error) {
+	var keys *auth.Jwks
+	if cfg.JwksFile != "" {
+		k, err := auth.NewJwksFromFile(cfg.JwksFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = k
+	} else {
+		keys = auth.NewJwksFromURL(cfg.JwksURL, cfg.JwksCacheTTL)
+	}
+
+	return &auth.JwtAuthenticator{
+		Keys:        keys,
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		RolesClaim:  cfg.RolesClaim,
+		RoleScopes:  cfg.RoleScopes,
+		UserIDClaim: cfg.UserIDClaim,
+		Leeway:      cfg.Leeway,
+	}, nil
+}
+
 func main() {
 	config.InitConfig()
 
-	r := gin.Default()
+	if err := logging.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := encryption.Init(config.GetEncryptionKeysFile()); err != nil {
+		log.Fatal(err)
+	}
+	db.InitValidation()
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.Connect(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	if config.GetDbAutoMigrate() {
+		if err := db.Init(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	r := gin.New()
+	// rate limits of anonymous clients are keyed by client IP, forwarded IPs of untrusted peers are ignored
+	if err := r.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatal(err)
+	}
+	r.Use(middleware.RequestID())
+	r.Use(metrics.GinMiddleware())
+	r.Use(otelgin.Middleware(config.GetTracingConfig().ServiceName))
+	r.Use(middleware.Logger())
+	r.Use(gin.Recovery())
 	docs.SwaggerInfo.BasePath = "/api/v1"
 
+	health.AddRoutes(r)
+	r.GET("/metrics", metrics.Handler())
+
 	v1 := r.Group("/api/v1")
+	v1.Use(middleware.Timeout(config.GetRequestTimeout()))
+
+	authConfig, err := config.GetAuthConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !authConfig.Enabled {
+		log.Warn("Authentication is disabled, every request is served with admin scope")
+	}
+	authenticators := []auth.Authenticator{
+		&auth.BasicAuthenticator{Realm: authConfig.Realm, Users: authConfig.BasicUsers},
+		&auth.ApiKeyAuthenticator{Store: db.ApiKeyStore{}},
+	}
+
+	jwtConfig, err := config.GetJwtConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if jwtConfig.Enabled {
+		jwtAuthenticator, err := newJwtAuthenticator(jwtConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+
+	rateLimitConfig := config.GetRateLimitConfig()
+	rateLimitStore := ratelimit.NewMemoryStore()
+	if rateLimitConfig.Enabled && authConfig.Enabled {
+		l := rateLimitConfig.Groups[ratelimit.GroupAuth]
+		v1.Use(ratelimit.AuthFailureMiddleware(rateLimitStore, ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}))
+	}
+	v1.Use(auth.Authenticate(authConfig.Enabled, authenticators...))
+
+	if _, err := config.GetGdprConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := config.GetOnDeleteConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	if rateLimitConfig.Enabled {
+		limits := map[string]ratelimit.Limit{}
+		for group, l := range rateLimitConfig.Groups {
+			limits[group] = ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}
+		}
+		v1.Use(ratelimit.Middleware(rateLimitStore, limits))
+	}
+	v1.Use(middleware.MaxBodySize(config.GetMaxBodyBytes()))
 
 	db.AddApiRoutes(v1)
 	go notifier.CreateObjectCreationNotifierFunc()(notifier.ObjectCreationNotificationChannel)
 	// go prod.CreateConsumerFunc()()
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
-	r.Run() // listen and serve on 0.0.0.0:8080
+
+	srv := &http.Server{Addr: config.GetListenAddress(), Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if purge := config.GetPurgeConfig(); purge.Interval > 0 {
+		go db.RunPurgeSchedule(ctx, purge.Interval, purge.Retention)
+	}
+	<-ctx.Done()
+
+	// flush pending spans before exit
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error(err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error(err)
+	}
 }
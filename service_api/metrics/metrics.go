@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "service_api"
+
+var (
+	HttpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of processed HTTP requests",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HttpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests being processed",
+	}, []string{"method", "route"})
+
+	DbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database queries",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	DbQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "Number of failed database queries",
+	}, []string{"operation", "table"})
+
+	KafkaWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "write_duration_seconds",
+		Help:      "Duration of kafka message writes",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	KafkaWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "write_failures_total",
+		Help:      "Number of failed kafka message writes",
+	})
+
+	EventsProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notifier",
+		Name:      "events_produced_total",
+		Help:      "Number of events written to kafka per entity type",
+	}, []string{"entity"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rejected by rate limiter per route group",
+	}, []string{"group"})
+)
+
+// RegisterDbStats exposes connection pool statistics of stats source
+func RegisterDbStats(stats prometheus.Collector) error {
+	return prometheus.Register(stats)
+}
+
+// RegisterQueueDepth exposes current length of notifier queue
+func RegisterQueueDepth(depth func() float64) error {
+	return prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "notifier",
+		Name:      "queue_depth",
+		Help:      "Number of events waiting to be written to kafka",
+	}, depth))
+}
+
+// GinMiddleware records count, latency and in-flight requests per route and status
+func GinMiddleware() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		route := g.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := g.Request.Method
+
+		inFlight := HttpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		g.Next()
+
+		status := strconv.Itoa(g.Writer.Status())
+		HttpRequestsTotal.WithLabelValues(method, route, status).Inc()
+		HttpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyTooLargeError is returned by reads of request body past the limit
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds <%d> bytes", e.Limit)
+}
+
+// limitedBody reports reads past the limit as BodyTooLargeError,
+// http.MaxBytesError is not available before go 1.19, so the error is recognized by its message
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && strings.Contains(err.Error(), "http: request body too large") {
+		err = &BodyTooLargeError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// MaxBodySize rejects requests with declared body larger than limit bytes
+// and stops reading bodies of unknown length past the limit
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if limit <= 0 {
+			g.Next()
+			return
+		}
+
+		if g.Request.ContentLength > limit {
+			err := &BodyTooLargeError{Limit: limit}
+			g.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+
+		g.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(g.Writer, g.Request.Body, limit), limit: limit}
+		g.Next()
+	}
+}
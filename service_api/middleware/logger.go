@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Logger writes access log line for every request through the structured logger
+func Logger() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		start := time.Now()
+		path := g.Request.URL.Path
+
+		g.Next()
+
+		entry := log.WithContext(g.Request.Context()).WithFields(log.Fields{
+			"method":     g.Request.Method,
+			"path":       path,
+			"route":      g.FullPath(),
+			"status":     g.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  g.ClientIP(),
+			"size":       g.Writer.Size(),
+		})
+
+		if len(g.Errors) > 0 {
+			entry.Error(g.Errors.String())
+			return
+		}
+
+		switch status := g.Writer.Status(); {
+		case status >= 500:
+			entry.Error("request failed")
+		case status >= 400:
+			entry.Warn("request rejected")
+		default:
+			entry.Info("request served")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"example/service/api/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID propagates X-Request-ID header of incoming request or generates a new one,
+// the id is returned in response header and stored in request context
+func RequestID() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id := g.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		g.Header(RequestIDHeader, id)
+		g.Request = g.Request.WithContext(logging.WithRequestID(g.Request.Context(), id))
+		g.Next()
+	}
+}
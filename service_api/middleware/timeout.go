@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout sets deadline on request context,
+// database queries started by handler are cancelled once it is exceeded
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if timeout <= 0 {
+			g.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(g.Request.Context(), timeout)
+		defer cancel()
+
+		g.Request = g.Request.WithContext(ctx)
+		g.Next()
+	}
+}
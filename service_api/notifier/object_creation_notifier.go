@@ -3,24 +3,51 @@ package producer
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log"
 	"reflect"
+	"time"
+
+	"example/service/api/logging"
+	"example/service/api/metrics"
+	"example/service/api/tracing"
 
 	kafka "github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var ObjectCreationNotificationChannel = make(chan interface{}, 50)
+// Event is an object queued for notification with context of the request that created it
+type Event struct {
+	Context   context.Context
+	RequestID string
+	Value     interface{}
+}
+
+const requestIdHeader = "X-Request-ID"
 
-type NotifierFunc func(chan interface{})
+var ObjectCreationNotificationChannel = make(chan Event, 50)
+
+type NotifierFunc func(chan Event)
+
+// Notify queues notification about created object v,
+// trace context of ctx is propagated to the kafka message
+func Notify(ctx context.Context, v interface{}) {
+	ObjectCreationNotificationChannel <- Event{
+		Context:   logging.WithRequestID(tracing.Detach(ctx), logging.RequestID(ctx)),
+		RequestID: logging.RequestID(ctx),
+		Value:     v,
+	}
+}
 
 func getKafkaWriter() *kafka.Writer {
 	viper.BindEnv("KAFKA_URL")
 	viper.BindEnv("OBJECT_CREATION_TOPIC_NAME")
 	kafka_url := viper.GetString("KAFKA_URL")
 	topic := viper.GetString("OBJECT_CREATION_TOPIC_NAME")
-	fmt.Printf("Creating kafka writer with url '%s' and topic '%s'", kafka_url, topic)
+	log.WithFields(log.Fields{"kafka_url": kafka_url, "topic": topic}).Info("Creating kafka writer")
 	return &kafka.Writer{
 		Addr:     kafka.TCP(kafka_url),
 		Topic:    topic,
@@ -30,27 +57,62 @@ func getKafkaWriter() *kafka.Writer {
 
 var kafkaWriter = getKafkaWriter()
 
-func KafkaNotifier(c chan interface{}) {
-	for val := range c {
+func KafkaNotifier(c chan Event) {
+	setRunning(true)
+	defer setRunning(false)
+
+	for e := range c {
+		val := e.Value
 		msg := make(map[string]interface{})
 		msg["type"] = reflect.TypeOf(val).Name()
 		msg["value"] = val
+		if e.RequestID != "" {
+			msg["request_id"] = e.RequestID
+		}
 		r, _ := json.Marshal(msg)
-		fmt.Println(string(r))
+
+		entry := log.WithContext(e.Context)
+		entry.WithField("event", logging.RedactJSON(r)).Debug("Sending notification")
 
 		kafka_msg := kafka.Message{
 			Key:   []byte(reflect.TypeOf(val).Name()),
 			Value: r,
 		}
+		if e.RequestID != "" {
+			kafka_msg.Headers = append(kafka_msg.Headers, kafka.Header{Key: requestIdHeader, Value: []byte(e.RequestID)})
+		}
+
+		ctx, span := tracing.Tracer().Start(e.Context, kafkaWriter.Topic+" send",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKey.String("kafka"),
+				semconv.MessagingDestinationKindTopic,
+				semconv.MessagingDestinationKey.String(kafkaWriter.Topic),
+				attribute.String("messaging.kafka.message_key", string(kafka_msg.Key)),
+			))
+		tracing.InjectKafkaHeaders(ctx, &kafka_msg)
 
-		err := kafkaWriter.WriteMessages(context.Background(), kafka_msg)
+		start := time.Now()
+		err := kafkaWriter.WriteMessages(ctx, kafka_msg)
+		metrics.KafkaWriteDuration.Observe(time.Since(start).Seconds())
+		recordWrite(err)
 
 		if err != nil {
-			log.Fatal("failed to write messages:", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			metrics.KafkaWriteFailures.Inc()
+			entry.WithError(err).Error("failed to write messages")
+			continue
 		}
+		span.End()
+		metrics.EventsProduced.WithLabelValues(reflect.TypeOf(val).Name()).Inc()
 	}
 }
 
 func CreateObjectCreationNotifierFunc() NotifierFunc {
+	metrics.RegisterQueueDepth(func() float64 {
+		return float64(len(ObjectCreationNotificationChannel))
+	})
 	return KafkaNotifier
 }
@@ -0,0 +1,84 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type Status struct {
+	Running       bool       `json:"running"`
+	QueueDepth    int        `json:"queue_depth"`
+	QueueCapacity int        `json:"queue_capacity"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	// LastError names brokers, it is logged on failure and not exposed by probes
+	LastError string `json:"-"`
+}
+
+// WriteFailureGrace is how long writes may keep failing before notifier is reported failing
+const WriteFailureGrace = 30 * time.Second
+
+// Healthy reports whether notifier is running and its queue has room for new events
+func (s Status) Healthy() bool {
+	return s.Running && s.QueueDepth < s.QueueCapacity
+}
+
+// WriteFailing reports whether the last write failed and no write succeeded within WriteFailureGrace
+func (s Status) WriteFailing(now time.Time) bool {
+	if s.LastErrorAt == nil || s.LastSuccessAt != nil && !s.LastErrorAt.After(*s.LastSuccessAt) {
+		return false
+	}
+	return s.LastSuccessAt == nil || now.Sub(*s.LastSuccessAt) > WriteFailureGrace
+}
+
+var state struct {
+	sync.Mutex
+	running       bool
+	lastSuccessAt *time.Time
+	lastErrorAt   *time.Time
+	lastError     string
+}
+
+func setRunning(running bool) {
+	state.Lock()
+	defer state.Unlock()
+	state.running = running
+}
+
+func recordWrite(err error) {
+	state.Lock()
+	defer state.Unlock()
+	now := time.Now().UTC()
+	if err != nil {
+		state.lastErrorAt = &now
+		state.lastError = err.Error()
+		return
+	}
+	state.lastSuccessAt = &now
+}
+
+func GetStatus() Status {
+	state.Lock()
+	defer state.Unlock()
+	return Status{
+		Running:       state.running,
+		QueueDepth:    len(ObjectCreationNotificationChannel),
+		QueueCapacity: cap(ObjectCreationNotificationChannel),
+		LastSuccessAt: state.lastSuccessAt,
+		LastErrorAt:   state.lastErrorAt,
+		LastError:     state.lastError,
+	}
+}
+
+// Ping checks that kafka broker used by notifier is reachable
+func Ping(ctx context.Context) error {
+	conn, err := kafka.DialContext(ctx, "tcp", kafkaWriter.Addr.String())
+	if err != nil {
+		return fmt.Errorf("can't connect to kafka: %w", err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/service/api/auth"
+	"example/service/api/metrics"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	GroupRead  = "read"
+	GroupWrite = "write"
+	GroupBatch = "batch"
+	// GroupAuth limits failed authentication attempts per client IP
+	GroupAuth = "auth"
+)
+
+// RouteGroup classifies request into one of the limit groups
+func RouteGroup(g *gin.Context) string {
+	switch {
+	case strings.HasSuffix(g.FullPath(), "/insert_batch"):
+		return GroupBatch
+	case g.Request.Method == http.MethodGet || g.Request.Method == http.MethodHead:
+		return GroupRead
+	default:
+		return GroupWrite
+	}
+}
+
+// ClientKey identifies the caller, authenticated principals are limited per principal
+// (API key, user or token subject) and anonymous requests per client IP
+func ClientKey(g *gin.Context) string {
+	if p := auth.FromGin(g); p != nil && p.Kind != "" {
+		return p.Kind + ":" + p.ID
+	}
+	return "ip:" + g.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Middleware enforces limits per client and route group and sets RateLimit-* headers.
+// Groups without configured limit are not limited. Requests are let through when store fails.
+func Middleware(store Store, limits map[string]Limit) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		group := RouteGroup(g)
+		limit, ok := limits[group]
+		if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+			g.Next()
+			return
+		}
+
+		result, err := store.Take(g.Request.Context(), group+":"+ClientKey(g), limit)
+		if err != nil {
+			log.WithContext(g.Request.Context()).Error("rate limiter failure: ", err)
+			g.Next()
+			return
+		}
+
+		g.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		g.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		g.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(group).Inc()
+			g.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			g.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit of <" + group + "> requests is exceeded"})
+			return
+		}
+		g.Next()
+	}
+}
+
+// AuthFailureMiddleware limits failed authentication attempts per client IP, it runs before authentication.
+// Every request reserves a token which is refunded unless the request is answered with 401,
+// so requests from IP without tokens are rejected before credentials are checked, concurrent ones too.
+func AuthFailureMiddleware(store Store, limit Limit) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if limit.Rate <= 0 || limit.Burst <= 0 {
+			g.Next()
+			return
+		}
+
+		key := GroupAuth + ":ip:" + g.ClientIP()
+		result, err := store.Take(g.Request.Context(), key, limit)
+		if err != nil {
+			log.WithContext(g.Request.Context()).Error("rate limiter failure: ", err)
+			g.Next()
+			return
+		}
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(GroupAuth).Inc()
+			g.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			g.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many failed authentication attempts"})
+			return
+		}
+
+		g.Next()
+
+		if g.Writer.Status() != http.StatusUnauthorized {
+			if err := store.Refund(g.Request.Context(), key, limit); err != nil {
+				log.WithContext(g.Request.Context()).Error("rate limiter failure: ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		requests       int
+		limits         map[string]Limit
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter string
+	}{
+		{"within limit", 2, map[string]Limit{GroupRead: {Rate: 1, Burst: 2}}, http.StatusOK, "0", ""},
+		{"limit exceeded", 3, map[string]Limit{GroupRead: {Rate: 0.5, Burst: 2}}, http.StatusTooManyRequests, "0", "2"},
+		{"group without limit", 3, map[string]Limit{GroupWrite: {Rate: 1, Burst: 1}}, http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Middleware(NewMemoryStore(), tt.limits))
+			r.GET("/movies", func(g *gin.Context) { g.Status(http.StatusOK) })
+
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				w = httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies", nil))
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %s, want %s", got, tt.wantRemaining)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %s, want %s", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAuthFailureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		statuses []int
+		want     []int
+	}{
+		{"failures up to burst", []int{401, 401}, []int{401, 401}},
+		{"failures past burst", []int{401, 401, 200}, []int{401, 401, 429}},
+		{"successes don't count", []int{200, 200, 200, 401, 401}, []int{200, 200, 200, 401, 401}},
+		{"other errors don't count", []int{403, 400, 401, 401, 403}, []int{403, 400, 401, 401, 429}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(AuthFailureMiddleware(NewMemoryStore(), Limit{Rate: 0.001, Burst: 2}))
+			i := 0
+			r.GET("/movies", func(g *gin.Context) {
+				g.Status(tt.statuses[i])
+			})
+
+			for i = range tt.statuses {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies", nil))
+				if w.Code != tt.want[i] {
+					t.Errorf("request %d status = %d, want %d", i, w.Code, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthFailureMiddlewareConcurrent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(AuthFailureMiddleware(NewMemoryStore(), Limit{Rate: 0.001, Burst: 3}))
+	r.GET("/movies", func(g *gin.Context) { g.Status(http.StatusUnauthorized) })
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	counts := map[int]int{}
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies", nil))
+			mu.Lock()
+			counts[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counts[http.StatusUnauthorized] != 3 {
+		t.Errorf("%d concurrent guesses got to authentication, want 3", counts[http.StatusUnauthorized])
+	}
+}
+
+func TestClientKeyIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	var key string
+	r.GET("/movies", func(g *gin.Context) { key = ClientKey(g) })
+
+	req := httptest.NewRequest(http.MethodGet, "/movies", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if key != "ip:192.0.2.1" {
+		t.Errorf("ClientKey() = %s, want ip:192.0.2.1", key)
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second holding at most Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result describes the bucket after a token was requested
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is time until next token is available, zero when the request is allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps limiter state, implementations backed by shared storage
+// allow several instances of the service to enforce common limits
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Refund puts back a token taken for request which turned out not to count against the limit
+	Refund(ctx context.Context, key string, limit Limit) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// sweepInterval is how often MemoryStore drops buckets that refilled completely
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	limits  map[string]Limit
+	swept   time.Time
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		limits:  map[string]Limit{},
+		swept:   time.Now(),
+		now:     time.Now,
+	}
+}
+
+func refill(b *bucket, limit Limit, now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.updated = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(key, limit)
+	result := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+
+	return result, nil
+}
+
+func (s *MemoryStore) Refund(ctx context.Context, key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(key, limit)
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+1)
+	return nil
+}
+
+// bucket returns refilled bucket of key, s.mu is held by caller
+func (s *MemoryStore) bucket(key string, limit Limit) *bucket {
+	now := s.now()
+	if now.Sub(s.swept) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+		s.limits[key] = limit
+	}
+	refill(b, limit, now)
+	return b
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		limit := s.limits[key]
+		refill(b, limit, now)
+		if b.tokens >= float64(limit.Burst) {
+			delete(s.buckets, key)
+			delete(s.limits, key)
+		}
+	}
+	s.swept = now
+}
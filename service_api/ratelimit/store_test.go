@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+
+	tests := []struct {
+		name string
+		// takes lists delays before successive takes
+		takes          []time.Duration
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+		wantReset      time.Duration
+	}{
+		{"first request", []time.Duration{0}, true, 2, 0, 500 * time.Millisecond},
+		{"burst", []time.Duration{0, 0, 0}, true, 0, 0, 1500 * time.Millisecond},
+		{"burst exceeded", []time.Duration{0, 0, 0, 0}, false, 0, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{"partial refill", []time.Duration{0, 0, 0, 250 * time.Millisecond}, false, 0, 250 * time.Millisecond, 1250 * time.Millisecond},
+		{"refilled token", []time.Duration{0, 0, 0, 500 * time.Millisecond}, true, 0, 0, 1500 * time.Millisecond},
+		{"refill is capped by burst", []time.Duration{0, time.Hour}, true, 2, 0, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			now := time.Unix(1000, 0)
+			s.now = func() time.Time { return now }
+
+			var result Result
+			for _, d := range tt.takes {
+				now = now.Add(d)
+				var err error
+				if result, err = s.Take(context.Background(), "key", limit); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", result.Allowed, tt.wantAllowed)
+			}
+			if result.Remaining != tt.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", result.Remaining, tt.wantRemaining)
+			}
+			if result.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %v, want %v", result.RetryAfter, tt.wantRetryAfter)
+			}
+			if result.Reset != tt.wantReset {
+				t.Errorf("Reset = %v, want %v", result.Reset, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeys(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	if r, _ := s.Take(context.Background(), "a", limit); !r.Allowed {
+		t.Fatal("first request of a is limited")
+	}
+	if r, _ := s.Take(context.Background(), "b", limit); !r.Allowed {
+		t.Error("limit of a applies to b")
+	}
+	if r, _ := s.Take(context.Background(), "a", limit); r.Allowed {
+		t.Error("second request of a is allowed")
+	}
+}
+
+func TestMemoryStoreRefund(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		s.Take(context.Background(), "key", limit)
+	}
+	if err := s.Refund(context.Background(), "key", limit); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := s.Take(context.Background(), "key", limit); !r.Allowed {
+		t.Error("refunded token isn't available")
+	}
+
+	for i := 0; i < 5; i++ {
+		s.Refund(context.Background(), "full", limit)
+	}
+	if r, _ := s.Take(context.Background(), "full", limit); r.Remaining != 1 {
+		t.Errorf("Remaining = %d after refunds to full bucket, want 1", r.Remaining)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	s.swept = now
+	limit := Limit{Rate: 1, Burst: 2}
+
+	s.Take(context.Background(), "idle", limit)
+	now = now.Add(2 * sweepInterval)
+	s.Take(context.Background(), "busy", limit)
+
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("refilled bucket is kept")
+	}
+	if _, ok := s.buckets["busy"]; !ok {
+		t.Error("bucket in use is dropped")
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	}
+
+	for _, tt := range tests {
+		if got := ceilSeconds(tt.d); got != tt.want {
+			t.Errorf("ceilSeconds(%v) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
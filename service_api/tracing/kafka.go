@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+
+	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+)
+
+// KafkaHeaderCarrier adapts kafka message headers to propagation.TextMapCarrier
+type KafkaHeaderCarrier struct {
+	Headers *[]kafka.Header
+}
+
+func (c KafkaHeaderCarrier) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c KafkaHeaderCarrier) Set(key string, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c KafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// InjectKafkaHeaders writes trace context of ctx into message headers
+func InjectKafkaHeaders(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, KafkaHeaderCarrier{Headers: &msg.Headers})
+}